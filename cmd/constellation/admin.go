@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bdubs00/constellation/internal/admin"
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+	"github.com/bdubs00/constellation/internal/proxy"
+)
+
+// serveAdmin serves the admin API for p on addr until the returned stop
+// function is called. A TCP address requires a token, read from
+// tokenFile.
+func serveAdmin(addr, tokenFile string, p *proxy.Proxy, serverName string, logger *audit.Logger) (stop func(), err error) {
+	var token string
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading admin token: %w", err)
+		}
+		if token = strings.TrimSpace(string(data)); token == "" {
+			return nil, fmt.Errorf("admin token file %s is empty", tokenFile)
+		}
+	}
+	ln, needToken, err := admin.Listen(addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for admin API: %w", err)
+	}
+	if needToken && token == "" {
+		ln.Close()
+		return nil, fmt.Errorf("--admin-addr %s is a TCP address and needs --admin-token-file; use unix:PATH to rely on file permissions instead", addr)
+	}
+
+	reload := func() error {
+		cfg, err := config.Load(policyPath)
+		if err != nil {
+			return fmt.Errorf("loading policy: %w", err)
+		}
+		srv, ok := cfg.Servers[serverName]
+		if !ok {
+			return fmt.Errorf("server %q not found in policy file", serverName)
+		}
+		p.SetEngine(policy.NewEngine(srv))
+		hash := p.Policy().Hash
+		logger.LogPolicyReload(serverName, policyPath, hash)
+		log.Printf("reloaded policy %s (%s)", policyPath, hash)
+		return nil
+	}
+	srv := &http.Server{
+		Handler:           admin.Handler(p, admin.Options{Token: token, Reload: reload}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("WARNING: admin API stopped: %v", err)
+		}
+	}()
+	log.Printf("serving admin API on %s", addr)
+	return func() { srv.Close() }, nil
+}
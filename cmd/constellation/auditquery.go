@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+)
+
+// auditFilterFlags are the record filters shared by audit tail, query and
+// stats.
+type auditFilterFlags struct {
+	event, session, server, tool string
+	decision                     string
+	since, until                 string
+	args                         []string
+}
+
+func (f *auditFilterFlags) register(fs *pflag.FlagSet) {
+	fs.StringVar(&f.event, "event", "tool_call", `record type to show, or "all"`)
+	fs.StringVar(&f.session, "session", "", "only records from this proxy session")
+	fs.StringVar(&f.server, "server", "", "only records for this server")
+	fs.StringVar(&f.tool, "tool", "", "only tools matching this glob")
+	fs.StringVar(&f.decision, "decision", "", "only allow or deny decisions")
+	fs.StringVar(&f.since, "since", "", "only records at or after this time (RFC 3339, date, or duration ago such as 2h)")
+	fs.StringVar(&f.until, "until", "", "only records at or before this time")
+	fs.StringArrayVar(&f.args, "arg", nil, "only calls whose argument matches, as key=glob (repeatable)")
+}
+
+func (f *auditFilterFlags) filter(now time.Time) (audit.Filter, error) {
+	filter := audit.Filter{Event: f.event, Session: f.session, Server: f.server, Tool: f.tool, Decision: f.decision}
+	if filter.Event == "all" {
+		filter.Event = ""
+	}
+	var err error
+	if filter.Since, err = parseTimeFlag(f.since, now); err != nil {
+		return filter, fmt.Errorf("--since: %w", err)
+	}
+	if filter.Until, err = parseTimeFlag(f.until, now); err != nil {
+		return filter, fmt.Errorf("--until: %w", err)
+	}
+	for _, arg := range f.args {
+		key, pattern, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return filter, fmt.Errorf("--arg %q: want key=glob", arg)
+		}
+		if filter.Args == nil {
+			filter.Args = map[string]string{}
+		}
+		filter.Args[key] = pattern
+	}
+	return filter, filter.Validate()
+}
+
+// parseTimeFlag accepts an RFC 3339 time, a date, or a duration meaning
+// that long before now.
+func parseTimeFlag(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time or duration", s)
+}
+
+// auditLogFiles expands each path to its rotated files followed by itself.
+// With no paths, the policy's audit.path is used.
+func auditLogFiles(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		cfg, err := config.Load(policyPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading policy: %w", err)
+		}
+		if cfg.Audit == nil || cfg.Audit.Path == "" {
+			return nil, fmt.Errorf("no audit log given and %s sets no audit.path", policyPath)
+		}
+		paths = []string{cfg.Audit.Path}
+	}
+	seen := map[string]bool{}
+	var files []string
+	for _, p := range paths {
+		expanded, err := audit.LogFiles(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(expanded) == 0 {
+			return nil, fmt.Errorf("%s: no such audit log", p)
+		}
+		for _, f := range expanded {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+var (
+	auditFilters auditFilterFlags
+	auditFormat  string
+	tailLines    int
+	tailFollow   bool
+	queryLimit   int
+	statsTop     int
+)
+
+func newAuditTailCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tail [AUDIT_LOG]",
+		Short: "Print the last audit records, optionally following new ones",
+		Long: `Print the last matching records of an audit log. With --follow, keep
+printing records as they are written, across rotation.
+
+Without AUDIT_LOG, the audit.path from --policy is used.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE:         tailAudit,
+	}
+	auditFilters.register(cmd.Flags())
+	cmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "path to policy file")
+	cmd.Flags().StringVar(&auditFormat, "format", "table", "output format: table, json or csv")
+	cmd.Flags().IntVarP(&tailLines, "lines", "n", 10, "number of records to print")
+	cmd.Flags().BoolVarP(&tailFollow, "follow", "f", false, "keep printing new records")
+	return cmd
+}
+
+func tailAudit(cmd *cobra.Command, args []string) error {
+	filter, err := auditFilters.filter(time.Now())
+	if err != nil {
+		return err
+	}
+	files, err := auditLogFiles(args)
+	if err != nil {
+		return err
+	}
+	printer, err := newRecordPrinter(auditFormat, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	// Only read the live file up to its current size; Follow picks up
+	// from there.
+	live := files[len(files)-1]
+	if strings.HasSuffix(live, ".gz") {
+		return fmt.Errorf("%s: tail needs the live audit log, not a rotated file", live)
+	}
+	info, err := os.Stat(live)
+	if err != nil {
+		return err
+	}
+	var last []audit.Record
+	keep := func(rec audit.Record) error {
+		if filter.Match(rec) {
+			last = append(last, rec)
+			if len(last) > tailLines {
+				last = last[1:]
+			}
+		}
+		return nil
+	}
+	if err := audit.ReadFiles(files[:len(files)-1], keep); err != nil {
+		return err
+	}
+	f, err := audit.OpenLog(live)
+	if err != nil {
+		return err
+	}
+	err = audit.ReadRecords(io.LimitReader(f, info.Size()), keep)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, rec := range last {
+		if err := printer.print(rec); err != nil {
+			return err
+		}
+	}
+	if err := printer.flush(); err != nil || !tailFollow {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return audit.Follow(ctx, live, info.Size(), 500*time.Millisecond, func(rec audit.Record) error {
+		if !filter.Match(rec) {
+			return nil
+		}
+		if err := printer.print(rec); err != nil {
+			return err
+		}
+		return printer.flush()
+	})
+}
+
+func newAuditQueryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query [AUDIT_LOG...]",
+		Short: "Search audit records",
+		Long: `Print the audit records matching every given filter, oldest first.
+Rotated and gzipped files of each log are read too.
+
+Without AUDIT_LOG, the audit.path from --policy is used.`,
+		SilenceUsage: true,
+		RunE:         queryAudit,
+	}
+	auditFilters.register(cmd.Flags())
+	cmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "path to policy file")
+	cmd.Flags().StringVar(&auditFormat, "format", "table", "output format: table, json or csv")
+	cmd.Flags().IntVar(&queryLimit, "limit", 0, "stop after this many records (0 for no limit)")
+	return cmd
+}
+
+// errLimit stops reading once --limit records have been printed.
+var errLimit = errors.New("limit reached")
+
+func queryAudit(cmd *cobra.Command, args []string) error {
+	filter, err := auditFilters.filter(time.Now())
+	if err != nil {
+		return err
+	}
+	files, err := auditLogFiles(args)
+	if err != nil {
+		return err
+	}
+	printer, err := newRecordPrinter(auditFormat, os.Stdout)
+	if err != nil {
+		return err
+	}
+	n := 0
+	err = audit.ReadFiles(files, func(rec audit.Record) error {
+		if !filter.Match(rec) {
+			return nil
+		}
+		if err := printer.print(rec); err != nil {
+			return err
+		}
+		if n++; queryLimit > 0 && n >= queryLimit {
+			return errLimit
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		return err
+	}
+	return printer.flush()
+}
+
+func newAuditStatsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats [AUDIT_LOG...]",
+		Short: "Summarise tool calls: top tools, deny rates and latency",
+		Long: `Summarise the tool calls matching the filters: total calls and deny
+rate, and for the most called tools their deny rate and latency
+percentiles. Latency is the upstream time recorded in each call's
+tool_result record; denied calls have none.
+
+Without AUDIT_LOG, the audit.path from --policy is used.`,
+		SilenceUsage: true,
+		RunE:         auditStats,
+	}
+	auditFilters.register(cmd.Flags())
+	cmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "path to policy file")
+	cmd.Flags().StringVar(&auditFormat, "format", "table", "output format: table, json or csv")
+	cmd.Flags().IntVar(&statsTop, "top", 10, "number of tools to list (0 for all)")
+	return cmd
+}
+
+func auditStats(cmd *cobra.Command, args []string) error {
+	filter, err := auditFilters.filter(time.Now())
+	if err != nil {
+		return err
+	}
+	files, err := auditLogFiles(args)
+	if err != nil {
+		return err
+	}
+	c := audit.NewStatsCollector()
+	err = audit.ReadFiles(files, func(rec audit.Record) error {
+		// Results carry no decision or arguments to filter on; the
+		// collector only keeps those that belong to a matching call.
+		if filter.Match(rec) || rec.Event == "tool_result" {
+			c.Add(rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return printStats(os.Stdout, auditFormat, c.Stats(statsTop))
+}
+
+func printStats(w io.Writer, format string, s audit.Stats) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"server", "tool", "calls", "denied", "deny_rate", "p50_ms", "p90_ms", "p99_ms", "max_ms"})
+		for _, t := range s.Tools {
+			cw.Write([]string{t.Server, t.Tool, strconv.Itoa(t.Calls), strconv.Itoa(t.Denied),
+				formatFloat(t.DenyRate), formatFloat(t.Latency.P50), formatFloat(t.Latency.P90),
+				formatFloat(t.Latency.P99), formatFloat(t.Latency.Max)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		fmt.Fprintf(w, "%d calls, %d denied (%.1f%%), latency p50 %sms p90 %sms p99 %sms\n\n",
+			s.Calls, s.Denied, 100*s.DenyRate, formatFloat(s.Latency.P50), formatFloat(s.Latency.P90), formatFloat(s.Latency.P99))
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERVER\tTOOL\tCALLS\tDENIED\tDENY %\tP50 MS\tP90 MS\tP99 MS")
+		for _, t := range s.Tools {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.1f\t%s\t%s\t%s\n", t.Server, t.Tool, t.Calls, t.Denied,
+				100*t.DenyRate, formatFloat(t.Latency.P50), formatFloat(t.Latency.P90), formatFloat(t.Latency.P99))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown format %q (want table, json or csv)", format)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// recordPrinter writes audit records as an aligned table, JSON lines (the
+// records as logged) or CSV.
+type recordPrinter struct {
+	format string
+	w      io.Writer
+	tw     *tabwriter.Writer
+	cw     *csv.Writer
+	header bool
+}
+
+var recordColumns = []string{"time", "session", "event", "server", "tool", "decision", "rule", "duration_ms", "arguments"}
+
+func newRecordPrinter(format string, w io.Writer) (*recordPrinter, error) {
+	p := &recordPrinter{format: format, w: w}
+	switch format {
+	case "table":
+		p.tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	case "csv":
+		p.cw = csv.NewWriter(w)
+	case "json":
+	default:
+		return nil, fmt.Errorf("unknown format %q (want table, json or csv)", format)
+	}
+	return p, nil
+}
+
+func (p *recordPrinter) print(rec audit.Record) error {
+	fields := []string{
+		rec.Timestamp.UTC().Format(time.RFC3339), rec.SessionID, rec.Event, rec.Server, rec.Tool,
+		rec.Decision, "", "", "",
+	}
+	if rec.Event == "tool_call" {
+		fields[6] = strconv.Itoa(rec.Rule)
+		fields[7] = strconv.FormatInt(rec.DurationMs, 10)
+		fields[8] = formatArgs(rec.Arguments)
+	}
+	if rec.Event == "tool_result" {
+		fields[5] = resultStatus(rec)
+		fields[7] = formatFloat(rec.LatencyMs)
+	}
+	switch p.format {
+	case "json":
+		_, err := fmt.Fprintf(p.w, "%s\n", rec.Raw)
+		return err
+	case "csv":
+		if !p.header {
+			p.cw.Write(recordColumns)
+			p.header = true
+		}
+		return p.cw.Write(fields)
+	}
+	if !p.header {
+		fmt.Fprintln(p.tw, strings.ToUpper(strings.Join(recordColumns, "\t")))
+		p.header = true
+	}
+	_, err := fmt.Fprintln(p.tw, strings.Join(fields, "\t"))
+	return err
+}
+
+// resultStatus summarises a tool_result in the decision column.
+func resultStatus(rec audit.Record) string {
+	switch {
+	case rec.ErrorCode != 0:
+		return fmt.Sprintf("rpc_error %d", rec.ErrorCode)
+	case rec.IsError:
+		return "error"
+	}
+	return "ok"
+}
+
+func (p *recordPrinter) flush() error {
+	switch {
+	case p.tw != nil:
+		return p.tw.Flush()
+	case p.cw != nil:
+		p.cw.Flush()
+		return p.cw.Error()
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/coverage"
+)
+
+var (
+	coverageServer     string
+	coverageReevaluate bool
+)
+
+func newCoverageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "coverage AUDIT_LOG...",
+		Short: "Report how often each policy rule matched in audit logs",
+		Long: `Report, for each server in the policy, how many logged calls each rule
+decided, which rules never fired, which calls fell through to a default
+deny, and which tools were called without any rule naming them.
+
+Calls are attributed using the matched_rule index recorded in the log.
+If the policy's rules have been reordered since the log was written, use
+--reevaluate to evaluate each call against the current policy instead.
+It evaluates the arguments as logged, after redaction, so a when clause
+can miss a call whose argument was redacted.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: reportCoverage,
+	}
+	cmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "path to policy file")
+	cmd.Flags().StringVar(&coverageServer, "server", "", "only report this server")
+	cmd.Flags().BoolVar(&coverageReevaluate, "reevaluate", false, "evaluate calls against the current policy instead of trusting matched_rule")
+	return cmd
+}
+
+func reportCoverage(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(policyPath)
+	if err != nil {
+		return fmt.Errorf("loading policy: %w", err)
+	}
+	if coverageServer != "" {
+		srv, ok := cfg.Servers[coverageServer]
+		if !ok {
+			return fmt.Errorf("server %q not found in policy file", coverageServer)
+		}
+		cfg.Servers = map[string]config.Server{coverageServer: srv}
+	}
+
+	var calls []audit.ToolCallEvent
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening audit log: %w", err)
+		}
+		err = audit.ReadRecords(f, func(rec audit.Record) error {
+			if rec.Event == "tool_call" {
+				calls = append(calls, rec.ToolCallEvent)
+			}
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading audit log %s: %w", path, err)
+		}
+	}
+
+	printCoverage(os.Stdout, coverage.Analyze(cfg, calls, coverageReevaluate))
+	return nil
+}
+
+func printCoverage(w io.Writer, report *coverage.Report) {
+	for i, s := range report.Servers {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "server %q: %d calls\n", s.Name, s.Calls)
+
+		fired := len(s.Rules) - len(s.Unused())
+		fmt.Fprintf(w, "\nrules (%d of %d fired):\n", fired, len(s.Rules))
+		for _, r := range s.Rules {
+			action := "deny "
+			if r.Rule.Allow {
+				action = "allow"
+			}
+			fmt.Fprintf(w, "  %6d  rule %d: %s %s", r.Hits, r.Index, action, r.Rule.Tool)
+			if len(r.Rule.When) > 0 {
+				fmt.Fprintf(w, " when %s", formatWhen(r.Rule.When))
+			}
+			if src := r.Rule.Source(); src.IsValid() {
+				fmt.Fprintf(w, "  (%s)", src)
+			}
+			fmt.Fprintln(w)
+		}
+
+		if unused := s.Unused(); len(unused) > 0 {
+			fmt.Fprintln(w, "\nnever fired:")
+			for _, r := range unused {
+				fmt.Fprintf(w, "  rule %d: %s\n", r.Index, r.Rule.Tool)
+			}
+		}
+		if len(s.DefaultDenials) > 0 {
+			fmt.Fprintln(w, "\ndenied by default:")
+			for _, tc := range s.DefaultDenials {
+				fmt.Fprintf(w, "  %6d  %s\n", tc.Count, tc.Tool)
+			}
+		}
+		if len(s.Unruled) > 0 {
+			fmt.Fprintln(w, "\ncalled with no rules:")
+			for _, tc := range s.Unruled {
+				fmt.Fprintf(w, "  %6d  %s\n", tc.Count, tc.Tool)
+			}
+		}
+		if s.Stale > 0 {
+			fmt.Fprintf(w, "\n%d calls reference rules that no longer exist; rerun with --reevaluate\n", s.Stale)
+		}
+	}
+}
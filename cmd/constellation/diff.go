@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policydiff"
+	"github.com/bdubs00/constellation/internal/policytest"
+)
+
+var (
+	diffAuditLogs []string
+	diffSuites    []string
+	diffNoSamples bool
+	diffExitCode  bool
+)
+
+func newDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff OLD_POLICY NEW_POLICY",
+		Short: "Show what a policy change permits or forbids",
+		Long: `Compare two policy files: servers added or removed, changed settings,
+rules added, removed or reordered. Then replay a corpus of tool calls
+through both policies and list every call whose decision changed.
+
+The corpus is built from sample calls synthesized from both policies'
+rule patterns, plus any calls in --audit-log files and --suite test files.
+Calls from audit logs carry their arguments as logged, after redaction,
+so redacted values are replayed as their markers.`,
+		Args: cobra.ExactArgs(2),
+		RunE: diffPolicies,
+	}
+	cmd.Flags().StringArrayVar(&diffAuditLogs, "audit-log", nil, "replay tool calls from this audit log (repeatable)")
+	cmd.Flags().StringArrayVar(&diffSuites, "suite", nil, "replay tool calls from this policy test suite (repeatable)")
+	cmd.Flags().BoolVar(&diffNoSamples, "no-samples", false, "do not synthesize sample calls from rule patterns")
+	cmd.Flags().BoolVar(&diffExitCode, "exit-code", false, "exit with status 1 if any decision changed")
+	return cmd
+}
+
+func diffPolicies(cmd *cobra.Command, args []string) error {
+	oldCfg, err := config.Load(args[0])
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", args[0], err)
+	}
+	newCfg, err := config.Load(args[1])
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", args[1], err)
+	}
+
+	var calls []policydiff.Call
+	if !diffNoSamples {
+		calls = policydiff.SampleCalls(oldCfg, newCfg)
+	}
+	for _, path := range diffAuditLogs {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening audit log: %w", err)
+		}
+		err = audit.ReadRecords(f, func(rec audit.Record) error {
+			if rec.Event == "tool_call" {
+				calls = append(calls, policydiff.Call{Server: rec.Server, Tool: rec.Tool, Arguments: rec.Arguments})
+			}
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading audit log %s: %w", path, err)
+		}
+	}
+	for _, path := range diffSuites {
+		suite, err := policytest.LoadSuite(path)
+		if err != nil {
+			return err
+		}
+		for _, tc := range suite.Tests {
+			calls = append(calls, policydiff.Call{Server: tc.Server, Tool: tc.Tool, Arguments: tc.Arguments})
+		}
+	}
+
+	d := policydiff.Compare(oldCfg, newCfg)
+	changes, replayed := policydiff.Replay(oldCfg, newCfg, calls)
+	printDiff(os.Stdout, d, changes, replayed)
+
+	if diffExitCode && len(changes) > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d decisions changed", len(changes))
+	}
+	return nil
+}
+
+func printDiff(w io.Writer, d *policydiff.Diff, changes []policydiff.Change, replayed int) {
+	if d.Empty() {
+		fmt.Fprintln(w, "no structural changes")
+	}
+	for _, name := range d.AddedServers {
+		fmt.Fprintf(w, "+ server %q\n", name)
+	}
+	for _, name := range d.RemovedServers {
+		fmt.Fprintf(w, "- server %q\n", name)
+	}
+	for _, s := range d.Servers {
+		fmt.Fprintf(w, "~ server %q\n", s.Name)
+		for _, c := range s.Changes {
+			fmt.Fprintf(w, "    %s\n", c)
+		}
+		for _, r := range s.RemovedRules {
+			fmt.Fprintf(w, "    - %s\n", describeRule(r))
+		}
+		for _, r := range s.AddedRules {
+			fmt.Fprintf(w, "    + %s\n", describeRule(r))
+		}
+		if s.Reordered {
+			fmt.Fprintln(w, "    rules reordered")
+		}
+	}
+
+	fmt.Fprintf(w, "\nreplayed %d calls, %d decisions changed\n", replayed, len(changes))
+	for _, c := range changes {
+		fmt.Fprintf(w, "  %s/%s %s: %s -> %s\n", c.Server, c.Tool, formatArgs(c.Arguments),
+			describeDecision(c.Old, c.OldMissing), describeDecision(c.New, c.NewMissing))
+	}
+}
+
+func describeRule(r config.Rule) string {
+	action := "deny"
+	if r.Allow {
+		action = "allow"
+	}
+	s := action + " " + r.Tool
+	if len(r.When) > 0 {
+		s += " when " + formatWhen(r.When)
+	}
+	return s
+}
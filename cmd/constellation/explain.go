@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+)
+
+var (
+	explainTool string
+	explainArgs string
+)
+
+func newExplainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "explain",
+		Short: "Trace how a tool call is evaluated against the policy",
+		RunE:  explainCall,
+	}
+	cmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "path to policy file")
+	cmd.Flags().String("server", "", "server name from policy file")
+	cmd.Flags().StringVar(&explainTool, "tool", "", "tool name")
+	cmd.Flags().StringVar(&explainArgs, "args", "{}", "tool arguments as a JSON object")
+	cmd.MarkFlagRequired("server")
+	cmd.MarkFlagRequired("tool")
+	return cmd
+}
+
+func explainCall(cmd *cobra.Command, args []string) error {
+	serverName, _ := cmd.Flags().GetString("server")
+
+	var arguments map[string]any
+	if err := json.Unmarshal([]byte(explainArgs), &arguments); err != nil {
+		return fmt.Errorf("parsing --args: %w", err)
+	}
+
+	cfg, err := config.Load(policyPath)
+	if err != nil {
+		return fmt.Errorf("loading policy: %w", err)
+	}
+	srv, ok := cfg.Servers[serverName]
+	if !ok {
+		return fmt.Errorf("server %q not found in policy file", serverName)
+	}
+
+	trace := policy.NewEngine(srv).Explain(explainTool, arguments)
+	printTrace(os.Stdout, serverName, srv.Default, trace)
+	return nil
+}
+
+func printTrace(w io.Writer, server, def string, t policy.Trace) {
+	fmt.Fprintf(w, "server %q, tool %q\n\n", server, t.Tool)
+
+	for _, r := range t.Rules {
+		action := "deny"
+		if r.Allow {
+			action = "allow"
+		}
+		fmt.Fprintf(w, "rule %d: %s %s", r.Index, action, r.Tool)
+		if r.Source != "" {
+			fmt.Fprintf(w, "  (%s)", r.Source)
+		}
+		fmt.Fprintln(w)
+
+		if !r.ToolMatched {
+			fmt.Fprintf(w, "  tool: %q != %q, skipped\n", r.Tool, t.Tool)
+			continue
+		}
+		fmt.Fprintln(w, "  tool: matched")
+		for _, c := range r.Clauses {
+			switch {
+			case !c.Present:
+				fmt.Fprintf(w, "  when %s: argument missing, pattern %q: no match\n", c.Key, c.Pattern)
+			case c.Matched:
+				fmt.Fprintf(w, "  when %s: %q matches %q\n", c.Key, c.Value, c.Pattern)
+			default:
+				fmt.Fprintf(w, "  when %s: %q does not match %q\n", c.Key, c.Value, c.Pattern)
+			}
+		}
+		if r.Matched {
+			fmt.Fprintln(w, "  => matched")
+		} else {
+			fmt.Fprintln(w, "  => not matched")
+		}
+	}
+	if len(t.Rules) == 0 {
+		fmt.Fprintln(w, "(server has no rules)")
+	}
+
+	decision := "deny"
+	if t.Decision.Allow {
+		decision = "allow"
+	}
+	fmt.Fprintf(w, "\ndecision: %s (%s)\n", decision, t.Decision.Reason)
+	if t.Fallthrough != "" {
+		fmt.Fprintf(w, "fell through to default %q: %s\n", def, t.Fallthrough)
+	}
+}
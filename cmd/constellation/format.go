@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bdubs00/constellation/internal/policy"
+)
+
+// formatWhen renders a rule's when clauses as {key: "pattern", ...} in
+// key order.
+func formatWhen(when map[string]string) string {
+	keys := make([]string, 0, len(when))
+	for k := range when {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s: %q", k, when[k])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// formatArgs renders tool call arguments as compact JSON.
+func formatArgs(args map[string]any) string {
+	if len(args) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Sprint(args)
+	}
+	return string(data)
+}
+
+// describeDecision renders a decision as "allow (rule 2)" or
+// "deny (default)". missing marks a server absent from the policy.
+func describeDecision(d policy.Decision, missing bool) string {
+	if missing {
+		return "no such server"
+	}
+	action := "deny"
+	if d.Allow {
+		action = "allow"
+	}
+	if d.MatchedRule < 0 {
+		return action + " (default)"
+	}
+	return fmt.Sprintf("%s (rule %d)", action, d.MatchedRule)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bdubs00/constellation/internal/learn"
+)
+
+var (
+	learnOutput    string
+	learnFromAudit []string
+)
+
+func newLearnCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "learn",
+		Short: "Propose policy rules from observed tool calls",
+		Long: `Run the proxy in dry-run mode, forwarding every call, and record the tool
+calls made. When the client disconnects, write a proposed rules: list for
+the server that allows exactly the kinds of calls observed, with paths
+generalized into globs.
+
+With --from-audit, no proxy is started: the proposal is built from the
+tool_call records of existing audit logs instead.
+
+Either way calls are learned from audit records, so arguments the policy's
+audit.redact settings remove, and resolved secrets, are seen as redacted
+markers rather than their values.`,
+		RunE: learnPolicy,
+	}
+	cmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "path to policy file")
+	cmd.Flags().StringVar(&auditLog, "audit-log", "", "path to audit log file (default: stderr)")
+	cmd.Flags().StringVar(&logLevel, "log-level", "info", "log level (debug, info, warn, error)")
+	cmd.Flags().StringVarP(&learnOutput, "output", "o", "", "write the proposed rules here (default: stderr)")
+	cmd.Flags().StringArrayVar(&learnFromAudit, "from-audit", nil, "learn from an existing audit log instead of running the proxy (repeatable)")
+	cmd.Flags().String("server", "", "server name from policy file")
+	cmd.MarkFlagRequired("server")
+	return cmd
+}
+
+func learnPolicy(cmd *cobra.Command, args []string) error {
+	serverName, _ := cmd.Flags().GetString("server")
+	rec := learn.NewRecorder(serverName)
+
+	if len(learnFromAudit) > 0 {
+		for _, path := range learnFromAudit {
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("opening audit log: %w", err)
+			}
+			err = rec.ReadLog(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("reading audit log %s: %w", path, err)
+			}
+		}
+	} else if err := serve(serverName, true, rec); err != nil {
+		return err
+	}
+
+	calls := rec.Calls()
+	if len(calls) == 0 {
+		return fmt.Errorf("no tool calls observed for server %q", serverName)
+	}
+
+	// stdout belongs to the MCP client while proxying, so the proposal
+	// goes to stderr unless a file is given.
+	var w io.Writer = os.Stderr
+	if learnOutput != "" {
+		f, err := os.Create(learnOutput)
+		if err != nil {
+			return fmt.Errorf("creating output: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := learn.WriteSnippet(w, serverName, learn.Propose(calls)); err != nil {
+		return fmt.Errorf("writing proposal: %w", err)
+	}
+	if learnOutput != "" {
+		fmt.Fprintf(os.Stderr, "proposed rules for %d tool calls written to %s\n", len(calls), learnOutput)
+	}
+	return nil
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/bdubs00/constellation/internal/config"
 	"github.com/bdubs00/constellation/internal/policy"
 	"github.com/bdubs00/constellation/internal/proxy"
+	"github.com/bdubs00/constellation/internal/recording"
 	"github.com/bdubs00/constellation/internal/secrets"
 )
 
@@ -18,6 +23,15 @@ var (
 	auditLog   string
 	logLevel   string
 	dryRun     bool
+	// metricsAddr, if set, is where serve exposes Prometheus metrics.
+	metricsAddr string
+	// traceEndpoint, if set, is the OTLP collector serve sends spans to.
+	traceEndpoint string
+	// adminAddr, if set, is where serve exposes the admin API.
+	adminAddr      string
+	adminTokenFile string
+	// recordPath, if set, is where serve records the session's messages.
+	recordPath string
 )
 
 func main() {
@@ -35,6 +49,11 @@ func main() {
 	runCmd.Flags().StringVar(&auditLog, "audit-log", "", "path to audit log file (default: stderr)")
 	runCmd.Flags().StringVar(&logLevel, "log-level", "info", "log level (debug, info, warn, error)")
 	runCmd.Flags().BoolVar(&dryRun, "dry-run", false, "evaluate policies but forward all calls")
+	runCmd.Flags().StringVar(&traceEndpoint, "trace-endpoint", "", "export OpenTelemetry traces to this OTLP/HTTP collector, e.g. http://localhost:4318 (default: $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	runCmd.Flags().StringVar(&adminAddr, "admin-addr", "", "serve the admin API on unix:PATH or a localhost address")
+	runCmd.Flags().StringVar(&adminTokenFile, "admin-token-file", "", "file holding the bearer token the admin API requires (needed for TCP)")
+	runCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "serve Prometheus metrics at /metrics on this address, e.g. localhost:9090")
+	runCmd.Flags().StringVar(&recordPath, "record", "", "record every message of the session to this JSON lines file, for constellation replay")
 	runCmd.Flags().String("server", "", "server name from policy file")
 	runCmd.MarkFlagRequired("server")
 
@@ -45,6 +64,12 @@ func main() {
 	}
 	validateCmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "path to policy file")
 
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema for policy files",
+		RunE:  printSchema,
+	}
+
 	versionCmd := &cobra.Command{
 		Use:   "version",
 		Short: "Print version",
@@ -53,16 +78,22 @@ func main() {
 		},
 	}
 
-	root.AddCommand(runCmd, validateCmd, versionCmd)
+	root.AddCommand(runCmd, validateCmd, schemaCmd, newTestCmd(), newExplainCmd(), newLearnCmd(), newCoverageCmd(), newDiffCmd(), newAuditCmd(), newReplayCmd(), newMockServerCmd(), versionCmd)
 
 	if err := root.Execute(); err != nil {
 		os.Exit(1)
 	}
+	exitIfTerminated()
 }
 
 func runProxy(cmd *cobra.Command, args []string) error {
 	serverName, _ := cmd.Flags().GetString("server")
+	return serve(serverName, dryRun, nil)
+}
 
+// serve runs the proxy for one server until the client disconnects. If tee
+// is non-nil it receives a copy of every audit record.
+func serve(serverName string, dryRun bool, tee io.Writer) error {
 	cfg, err := config.Load(policyPath)
 	if err != nil {
 		return fmt.Errorf("loading policy: %w", err)
@@ -72,56 +103,179 @@ func runProxy(cmd *cobra.Command, args []string) error {
 	if !ok {
 		return fmt.Errorf("server %q not found in policy file", serverName)
 	}
+	if metricsAddr != "" {
+		stopMetrics, err := serveMetrics(metricsAddr)
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+	}
 
 	// Set up audit logger
-	var auditWriter *os.File
-	if auditLog != "" {
-		f, err := os.OpenFile(auditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	auditPath := auditLog
+	if auditPath == "" && cfg.Audit != nil {
+		auditPath = cfg.Audit.Path
+	}
+	var lastRecord []byte
+	if auditPath != "" {
+		// Continue the hash chain from the previous run's last record.
+		if lastRecord, err = audit.LastRecord(auditPath); err != nil {
+			return fmt.Errorf("reading audit log: %w", err)
+		}
+	}
+	sinks, files, err := openAuditSinks(auditPath, cfg.Audit)
+	if err != nil {
+		return err
+	}
+	if tee != nil {
+		sinks = append(sinks, audit.NewWriterSink("tee", tee))
+	}
+	logger := audit.NewWithSinks(sinks...)
+	defer logger.Close()
+	stop := reopenOnHangup(files...)
+	defer stop()
+	level, err := audit.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(level)
+	if lastRecord != nil {
+		if err := logger.Resume(lastRecord); err != nil {
+			log.Printf("WARNING: starting a new audit hash chain: %v", err)
+		}
+	}
+	if a := cfg.Audit; a != nil && a.SigningKey != "" {
+		key, err := audit.LoadPrivateKey(a.SigningKey)
 		if err != nil {
-			return fmt.Errorf("opening audit log: %w", err)
+			return fmt.Errorf("loading audit signing key: %w", err)
 		}
-		defer f.Close()
-		auditWriter = f
-	} else {
-		auditWriter = os.Stderr
-	}
-	logger := audit.New(auditWriter)
-
-	// Resolve secrets
-	extraEnv := map[string]string{}
-	if srv.Secrets != nil && len(srv.Secrets.Env) > 0 {
-		providers := map[string]secrets.Provider{
-			"env": secrets.NewStaticProvider(),
+		logger.SetSigner(key, a.CheckpointEvery)
+	}
+	queueSize, overflow := 0, audit.OverflowBlock
+	if a := cfg.Audit; a != nil {
+		queueSize = a.QueueSize
+		if overflow, err = audit.ParseOverflowPolicy(a.Overflow); err != nil {
+			return err
+		}
+	}
+	logger.StartQueue(queueSize, overflow)
+	if a := cfg.Audit; a != nil {
+		mode, err := audit.ParseResultBodyMode(a.ResultBody)
+		if err != nil {
+			return err
 		}
+		logger.SetResultBody(mode, a.ResultBodyMax)
+	}
 
-		// Set up Vault provider if configured
-		if cfg.Vault != nil {
-			vaultProvider, err := secrets.NewVaultProvider(*cfg.Vault)
-			if err != nil {
-				return fmt.Errorf("initializing vault: %w", err)
-			}
-			cancel := vaultProvider.StartRenewal()
-			defer cancel()
-			providers["vault"] = vaultProvider
+	extraEnv, stopRenewal, err := resolveSecrets(cfg, srv)
+	if err != nil {
+		return err
+	}
+	defer stopRenewal()
+
+	// Redact configured argument patterns and every resolved secret value.
+	var redactOpts audit.RedactOptions
+	if a := cfg.Audit; a != nil && a.Redact != nil {
+		r := a.Redact
+		redactOpts = audit.RedactOptions{
+			Keys:           r.Keys,
+			Values:         r.Values,
+			DetectSecrets:  r.DetectSecrets,
+			MaxValueLength: r.MaxValueLength,
+			Hash:           r.Hash,
+			HashSalt:       r.HashSalt,
 		}
+	}
+	redactor, err := audit.NewRedactor(redactOpts)
+	if err != nil {
+		return err
+	}
+	redactor.AddSecrets(extraEnv)
+	logger.SetRedactor(redactor)
 
-		resolved, err := secrets.Resolve(srv.Secrets.Env, providers)
+	engine := policy.NewEngine(srv)
+
+	tracer := newTracer(traceEndpoint)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tracer.Shutdown(ctx)
+	}()
+
+	p := proxy.New(serverName, engine, logger, tracer, dryRun)
+	stopTerm := stopOnTerminate(p.Stop)
+	defer stopTerm()
+	if recordPath != "" {
+		rec, err := recording.Create(recordPath)
+		if err != nil {
+			return err
+		}
+		defer rec.Close()
+		rec.SetScrubber(func(data []byte) []byte { return redactor.ScrubSecrets(data) })
+		p.SetRecorder(rec)
+	}
+	if adminAddr != "" {
+		stopAdmin, err := serveAdmin(adminAddr, adminTokenFile, p, serverName, logger)
 		if err != nil {
-			return fmt.Errorf("resolving secrets: %w", err)
+			return err
 		}
-		extraEnv = resolved
+		defer stopAdmin()
 	}
+	err = p.Serve(srv, extraEnv)
+	if terminatedBy.Load() != nil {
+		// The server was stopped on our signal; its exit status says
+		// nothing about the session.
+		return nil
+	}
+	return err
+}
 
-	engine := policy.NewEngine(srv)
+// resolveSecrets resolves the environment variables srv takes from secret
+// providers. The returned function stops renewing the Vault token.
+func resolveSecrets(cfg *config.Config, srv config.Server) (map[string]string, func(), error) {
+	if srv.Secrets == nil || len(srv.Secrets.Env) == 0 {
+		return map[string]string{}, func() {}, nil
+	}
+	providers := map[string]secrets.Provider{
+		"env": secrets.NewStaticProvider(),
+	}
 
-	return proxy.Run(serverName, srv, engine, logger, dryRun, extraEnv)
+	// Set up Vault provider if configured
+	stop := func() {}
+	if cfg.Vault != nil {
+		vaultProvider, err := secrets.NewVaultProvider(*cfg.Vault)
+		if err != nil {
+			return nil, nil, fmt.Errorf("initializing vault: %w", err)
+		}
+		stop = vaultProvider.StartRenewal()
+		providers["vault"] = vaultProvider
+	}
+
+	resolved, err := secrets.Resolve(srv.Secrets.Env, providers)
+	if err != nil {
+		stop()
+		return nil, nil, fmt.Errorf("resolving secrets: %w", err)
+	}
+	return resolved, stop, nil
 }
 
 func validatePolicy(cmd *cobra.Command, args []string) error {
-	_, err := config.Load(policyPath)
+	cfg, err := config.Load(policyPath)
 	if err != nil {
 		return err
 	}
+	for _, w := range config.Lint(cfg) {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
 	fmt.Println("policy file is valid")
 	return nil
 }
+
+func printSchema(cmd *cobra.Command, args []string) error {
+	data, err := config.SchemaJSON()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bdubs00/constellation/internal/metrics"
+)
+
+// serveMetrics serves Prometheus metrics on addr at /metrics until the
+// returned stop function is called.
+func serveMetrics(addr string) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("WARNING: metrics server stopped: %v", err)
+		}
+	}()
+	log.Printf("serving metrics on http://%s/metrics", ln.Addr())
+	return func() { srv.Close() }, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bdubs00/constellation/internal/mockserver"
+)
+
+var mockHTTPAddr string
+
+func newMockServerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mock-server spec.yaml",
+		Short: "Run an MCP server described by a spec file",
+		Long: `Run an MCP server whose tools, resources and prompts are described in a
+YAML or JSON file, for developing and testing policies without the real
+server:
+
+  server: {name: files, version: 1.0.0}
+  tools:
+    - name: read_file
+      description: Read a file
+      input_schema: {type: object, properties: {path: {type: string}}}
+      response:
+        text: "contents of {{.Args.path}}"
+    - name: delete_file
+      response: {text: "cannot delete {{.Args.path}}", is_error: true}
+  resources:
+    - {uri: "file:///readme.md", name: readme, mime_type: text/markdown, text: "# Hello"}
+  prompts:
+    - name: summarize
+      arguments: [{name: topic, required: true}]
+      messages: [{role: user, text: "Summarize {{.Args.topic}}"}]
+
+Tool responses are Go templates with .Tool and .Args; a tool without a
+response echoes its arguments. The server speaks stdio, or with --http
+the streamable HTTP transport at /mcp.`,
+		Args:         cobra.ExactArgs(1),
+		RunE:         runMockServer,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVar(&mockHTTPAddr, "http", "", "serve HTTP on this address instead of stdio, e.g. localhost:8080")
+	return cmd
+}
+
+func runMockServer(cmd *cobra.Command, args []string) error {
+	spec, err := mockserver.LoadSpec(args[0])
+	if err != nil {
+		return err
+	}
+	srv := mockserver.New(spec)
+	if mockHTTPAddr == "" {
+		return srv.ServeStdio(os.Stdin, os.Stdout)
+	}
+
+	ln, err := net.Listen("tcp", mockHTTPAddr)
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+	log.Printf("serving mock MCP server %q on http://%s/mcp", spec.Server.Name, ln.Addr())
+	return (&http.Server{Handler: srv.Handler(), ReadHeaderTimeout: 5 * time.Second}).Serve(ln)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/recording"
+	"github.com/bdubs00/constellation/internal/replay"
+)
+
+var (
+	replayLive    bool
+	replayTimeout time.Duration
+)
+
+func newReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay session.jsonl",
+		Short: "Replay a recorded session against the current policy",
+		Long: `Replay the client side of a session recorded with run --record through
+the proxy, enforcing the current policy, and report tool calls it decides
+differently from the recording.
+
+Requests are answered with the recorded server responses, or with --live
+by starting the server from the policy file. Exits non-zero if any
+decision diverges.`,
+		Args:         cobra.ExactArgs(1),
+		RunE:         replaySession,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "path to policy file")
+	cmd.Flags().String("server", "", "server name from policy file")
+	cmd.Flags().BoolVar(&replayLive, "live", false, "replay against the server instead of the recorded responses")
+	cmd.Flags().DurationVar(&replayTimeout, "timeout", replay.DefaultTimeout, "how long to wait for each response")
+	cmd.MarkFlagRequired("server")
+	return cmd
+}
+
+func replaySession(cmd *cobra.Command, args []string) error {
+	serverName, _ := cmd.Flags().GetString("server")
+
+	entries, err := recording.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(policyPath)
+	if err != nil {
+		return fmt.Errorf("loading policy: %w", err)
+	}
+	srv, ok := cfg.Servers[serverName]
+	if !ok {
+		return fmt.Errorf("server %q not found in policy file", serverName)
+	}
+
+	opts := replay.Options{
+		Server:  serverName,
+		Config:  srv,
+		Live:    replayLive,
+		Timeout: replayTimeout,
+	}
+	if replayLive {
+		env, stop, err := resolveSecrets(cfg, srv)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		opts.Env = env
+	}
+
+	report, err := replay.Run(entries, opts)
+	if err != nil {
+		return err
+	}
+	diverged := printReplay(os.Stdout, report)
+	if diverged > 0 {
+		return fmt.Errorf("replayed decisions diverged")
+	}
+	return nil
+}
+
+// printReplay lists the diverging calls and a summary, and returns how
+// many diverged.
+func printReplay(w io.Writer, r *replay.Report) int {
+	divergences := r.Divergences()
+	for _, c := range divergences {
+		replayed := c.Replayed
+		if replayed == "" {
+			replayed = "not replayed"
+		}
+		fmt.Fprintf(w, "--- DIVERGED: %s (request %v): recorded %s, replayed %s\n", c.Tool, c.RequestID, c.Recorded, replayed)
+	}
+	if r.Unrecorded > 0 {
+		fmt.Fprintf(w, "%d requests had no recorded response\n", r.Unrecorded)
+	}
+	if r.Unanswered > 0 {
+		fmt.Fprintf(w, "%d requests got no response\n", r.Unanswered)
+	}
+	if len(divergences) > 0 {
+		fmt.Fprintf(w, "FAIL: %d of %d decisions diverged\n", len(divergences), len(r.Calls))
+	} else {
+		fmt.Fprintf(w, "ok: %d decisions match the recording\n", len(r.Calls))
+	}
+	return len(divergences)
+}
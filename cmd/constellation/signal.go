@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/bdubs00/constellation/internal/audit"
+)
+
+// reopenOnHangup reopens the audit log files whenever the process receives
+// SIGHUP, so external tools like logrotate can move the file away. Call
+// the returned function to stop listening.
+func reopenOnHangup(files ...*audit.RotatingFile) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				for _, f := range files {
+					if err := f.Reopen(); err != nil {
+						log.Printf("WARNING: reopening audit log: %v", err)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// terminatedBy holds the signal that stopped serve, if any.
+var terminatedBy atomic.Value
+
+// stopOnTerminate calls stop when the process is interrupted or
+// terminated, so that serve returns and its deferred cleanup runs: the
+// audit queue is drained, the recording closed and the tracer flushed.
+// main then exits with the signal's status. Call the returned function to
+// stop listening.
+func stopOnTerminate(stop func()) (cancel func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			terminatedBy.Store(sig)
+			stop()
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// exitIfTerminated exits with the conventional status for the signal that
+// stopped serve, if one did.
+func exitIfTerminated() {
+	if sig, ok := terminatedBy.Load().(os.Signal); ok {
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}
+}
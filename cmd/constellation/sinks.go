@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+)
+
+// openAuditSinks opens the primary audit log at path, if any, and every sink
+// configured in the audit section. With neither, records go to stderr. The
+// rotating files are returned so they can be reopened on SIGHUP.
+func openAuditSinks(path string, cfg *config.AuditConfig) (sinks []audit.Sink, files []*audit.RotatingFile, err error) {
+	defer func() {
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
+			}
+		}
+	}()
+
+	var rotate audit.RotateOptions
+	var configured []config.SinkConfig
+	if cfg != nil {
+		rotate = audit.RotateOptions{
+			MaxSize:  int64(cfg.MaxSizeMB) << 20,
+			Interval: cfg.RotateEvery,
+			Compress: cfg.Compress,
+			MaxFiles: cfg.MaxFiles,
+			MaxAge:   cfg.MaxAge,
+		}
+		configured = cfg.Sinks
+	}
+
+	openFile := func(path string) error {
+		f, err := audit.OpenRotatingFile(path, rotate)
+		if err != nil {
+			return fmt.Errorf("opening audit log: %w", err)
+		}
+		files = append(files, f)
+		sinks = append(sinks, audit.NewWriterSink("file "+path, f))
+		return nil
+	}
+
+	if path != "" {
+		if err := openFile(path); err != nil {
+			return nil, nil, err
+		}
+	} else if len(configured) == 0 {
+		sinks = append(sinks, audit.NewWriterSink("stderr", os.Stderr))
+	}
+
+	for i, sc := range configured {
+		batch := audit.BatchOptions{
+			BufferSize:    sc.BufferSize,
+			BatchSize:     sc.BatchSize,
+			FlushInterval: sc.FlushInterval,
+			Timeout:       sc.Timeout,
+		}
+		if sc.MaxRetries != nil {
+			// BatchOptions reads zero as the default, so an explicit 0
+			// becomes "no retries".
+			batch.MaxRetries = *sc.MaxRetries
+			if batch.MaxRetries == 0 {
+				batch.MaxRetries = -1
+			}
+		}
+		switch sc.Type {
+		case "file":
+			if err := openFile(sc.Path); err != nil {
+				return nil, nil, err
+			}
+		case "stderr":
+			sinks = append(sinks, audit.NewWriterSink("stderr", os.Stderr))
+		case "syslog":
+			s, err := audit.NewSyslogSink(audit.SyslogOptions{
+				Network:  sc.Network,
+				Address:  sc.Address,
+				Facility: sc.Facility,
+				AppName:  sc.AppName,
+			}, batch)
+			if err != nil {
+				return nil, nil, fmt.Errorf("audit sink %d: %w", i, err)
+			}
+			sinks = append(sinks, s)
+		case "webhook":
+			sinks = append(sinks, audit.NewWebhookSink(audit.HTTPOptions{URL: sc.URL, Headers: sc.Headers}, batch))
+		case "otlp":
+			sinks = append(sinks, audit.NewOTLPSink(audit.HTTPOptions{URL: sc.URL, Headers: sc.Headers}, batch))
+		default:
+			return nil, nil, fmt.Errorf("audit sink %d: unknown type %q", i, sc.Type)
+		}
+	}
+	return sinks, files, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policytest"
+)
+
+var testVerbose bool
+
+func newTestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test [suite.yaml|dir]...",
+		Short: "Run declarative policy tests",
+		Long: `Run policy test suites without starting any MCP server.
+
+Each suite lists tool calls and the decision the policy should make:
+
+  policy: constellation.yaml   # optional, relative to the suite
+  tests:
+    - name: public files are readable
+      server: filesystem
+      tool: read_file
+      arguments: {path: /public/readme.md}
+      expect: allow
+      rule: 0                  # optional, -1 for the server default
+
+Directories are searched for *_test.yaml files. With no arguments the
+current directory is searched.`,
+		RunE:         runPolicyTests,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVar(&policyPath, "policy", "constellation.yaml", "policy file for suites that do not name one")
+	cmd.Flags().BoolVarP(&testVerbose, "verbose", "v", false, "also list passing tests")
+	return cmd
+}
+
+func runPolicyTests(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	files, err := findSuites(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no test suites found")
+	}
+
+	policies := map[string]*config.Config{}
+	var total, failed int
+	for _, file := range files {
+		suite, err := policytest.LoadSuite(file)
+		if err != nil {
+			return err
+		}
+		path := suite.PolicyPath(policyPath)
+		cfg, ok := policies[path]
+		if !ok {
+			if cfg, err = config.Load(path); err != nil {
+				return fmt.Errorf("loading policy for %s: %w", file, err)
+			}
+			policies[path] = cfg
+		}
+
+		for _, r := range policytest.Run(cfg, suite.Tests) {
+			total++
+			if !r.Passed() {
+				failed++
+			}
+			printResult(os.Stdout, file, r)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAIL: %d of %d policy tests failed\n", failed, total)
+		return fmt.Errorf("policy tests failed")
+	}
+	fmt.Printf("ok: %d policy tests passed\n", total)
+	return nil
+}
+
+// findSuites expands directories into the *_test.yaml files they contain.
+func findSuites(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), "_test.yaml") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func printResult(w io.Writer, file string, r policytest.Result) {
+	tc := r.Case
+	if r.Passed() {
+		if testVerbose {
+			fmt.Fprintf(w, "--- PASS: %s (%s/%s)\n", tc.Name, tc.Server, tc.Tool)
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "--- FAIL: %s (%s/%s) in %s\n", tc.Name, tc.Server, tc.Tool, file)
+	if r.Err != nil {
+		fmt.Fprintf(w, "    error: %v\n", r.Err)
+		return
+	}
+	got := "deny"
+	if r.Decision.Allow {
+		got = "allow"
+	}
+	fmt.Fprintf(w, "    got %s, want %s\n", got, tc.Expect)
+	if tc.Rule != nil && *tc.Rule != r.Decision.MatchedRule {
+		fmt.Fprintf(w, "    decided by rule %d, want rule %d\n", r.Decision.MatchedRule, *tc.Rule)
+	}
+	if r.Rule == nil {
+		fmt.Fprintf(w, "    matched: server default (%s)\n", r.Decision.Reason)
+		return
+	}
+	fmt.Fprintf(w, "    matched: rule %d: tool %q allow=%v", r.Decision.MatchedRule, r.Rule.Tool, r.Rule.Allow)
+	if len(r.Rule.When) > 0 {
+		fmt.Fprintf(w, " when %s", formatWhen(r.Rule.When))
+	}
+	if src := r.Rule.Source(); src.IsValid() {
+		fmt.Fprintf(w, " (%s)", src)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bdubs00/constellation/internal/tracing"
+)
+
+// newTracer returns a tracer exporting to endpoint, or to the collector
+// named by the standard OTEL_EXPORTER_OTLP_* environment variables when
+// endpoint is empty. It returns nil, disabling tracing, if neither is set.
+func newTracer(endpoint string) *tracing.Tracer {
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		return nil
+	}
+	return tracing.NewTracer(tracing.NewOTLPExporter(tracing.OTLPOptions{
+		URL:         endpoint,
+		Headers:     parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+	}))
+}
+
+// parseOTLPHeaders parses the k1=v1,k2=v2 format of
+// OTEL_EXPORTER_OTLP_HEADERS, whose values are URL-encoded.
+func parseOTLPHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if dec, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = dec
+		}
+		headers[strings.TrimSpace(k)] = v
+	}
+	return headers
+}
@@ -0,0 +1,170 @@
+// Package admin serves a local HTTP API for inspecting and controlling a
+// running proxy.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bdubs00/constellation/internal/proxy"
+)
+
+// Options configures the admin API.
+type Options struct {
+	// Token, if set, must be presented as "Authorization: Bearer <token>".
+	Token string
+	// Reload loads the policy again and installs it in the proxy.
+	Reload func() error
+	// DrainTimeout bounds how long POST /drain waits for calls in flight
+	// when the request gives no timeout.
+	DrainTimeout time.Duration
+}
+
+// Handler returns the admin API for p:
+//
+//	GET  /healthz    the process is up
+//	GET  /readyz     the server is running and initialized, and not draining
+//	GET  /policy     the enforced policy and its hash
+//	GET  /sessions   the client session
+//	GET  /calls      tool calls awaiting a response
+//	GET  /decisions  recent decisions, newest first (?limit=N)
+//	POST /reload     reload the policy file
+//	POST /drain      deny new calls and wait for those in flight (?timeout=30s)
+func Handler(p *proxy.Proxy, opts Options) http.Handler {
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = 30 * time.Second
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ready, reason := p.Ready(); !ready {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "not ready", "reason": reason})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ready"})
+	})
+	mux.HandleFunc("GET /policy", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, p.Policy())
+	})
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []proxy.SessionInfo{p.Session()})
+	})
+	mux.HandleFunc("GET /calls", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, p.InFlight())
+	})
+	mux.HandleFunc("GET /decisions", func(w http.ResponseWriter, r *http.Request) {
+		limit := 0
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", s))
+				return
+			}
+			limit = n
+		}
+		writeJSON(w, http.StatusOK, p.RecentDecisions(limit))
+	})
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		if opts.Reload == nil {
+			writeError(w, http.StatusNotImplemented, errors.New("reload is not available"))
+			return
+		}
+		if err := opts.Reload(); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Policy())
+	})
+	mux.HandleFunc("POST /drain", func(w http.ResponseWriter, r *http.Request) {
+		timeout := opts.DrainTimeout
+		if s := r.URL.Query().Get("timeout"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout %q", s))
+				return
+			}
+			timeout = d
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		remaining := p.Drain(ctx)
+		status := http.StatusOK
+		if remaining > 0 {
+			status = http.StatusAccepted
+		}
+		writeJSON(w, status, map[string]any{"draining": true, "in_flight": remaining})
+	})
+	if opts.Token == "" {
+		return mux
+	}
+	return requireToken(opts.Token, mux)
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]any{"error": err.Error()})
+}
+
+// Listen opens the admin listener. An address of the form unix:PATH is a
+// unix socket, created readable and writable only by the owner; any stale
+// socket at PATH is replaced. Otherwise addr is a TCP address, which must
+// be on a loopback interface; requireToken reports whether the caller must
+// then insist on a token.
+func Listen(addr string) (ln net.Listener, requireToken bool, err error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			ln.Close()
+			return nil, false, err
+		}
+		return ln, false, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, false, err
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, false, fmt.Errorf("admin address %s is not a loopback address; use localhost or a unix socket", addr)
+		}
+	}
+	ln, err = net.Listen("tcp", addr)
+	return ln, true, err
+}
@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+	"github.com/bdubs00/constellation/internal/proxy"
+)
+
+func newProxy() *proxy.Proxy {
+	engine := policy.NewEngine(config.Server{
+		Default: "deny",
+		Rules:   []config.Rule{{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**"}}},
+	})
+	return proxy.New("fs", engine, audit.New(io.Discard), nil, false)
+}
+
+func do(t *testing.T, h http.Handler, method, path, token string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var body map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Code, body
+}
+
+func TestHandler(t *testing.T) {
+	p := newProxy()
+	reloaded := false
+	h := Handler(p, Options{Reload: func() error {
+		reloaded = true
+		p.SetEngine(policy.NewEngine(config.Server{Default: "deny"}))
+		return nil
+	}})
+
+	if code, _ := do(t, h, "GET", "/healthz", ""); code != http.StatusOK {
+		t.Errorf("healthz = %d", code)
+	}
+	if code, body := do(t, h, "GET", "/readyz", ""); code != http.StatusServiceUnavailable || body["reason"] != "server process not running" {
+		t.Errorf("readyz = %d %v", code, body)
+	}
+
+	_, before := do(t, h, "GET", "/policy", "")
+	if !strings.HasPrefix(before["hash"].(string), "sha256:") || before["default"] != "deny" {
+		t.Errorf("policy = %v", before)
+	}
+	code, after := do(t, h, "POST", "/reload", "")
+	if code != http.StatusOK || !reloaded || after["hash"] == before["hash"] {
+		t.Errorf("reload = %d %v (reloaded %v)", code, after, reloaded)
+	}
+	if code, _ := do(t, h, "GET", "/reload", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /reload = %d, want 405", code)
+	}
+
+	if code, body := do(t, h, "POST", "/drain?timeout=1s", ""); code != http.StatusOK || body["in_flight"] != 0.0 {
+		t.Errorf("drain = %d %v", code, body)
+	}
+	if !p.Draining() {
+		t.Error("proxy not draining after POST /drain")
+	}
+	if code, _ := do(t, h, "GET", "/decisions?limit=x", ""); code != http.StatusBadRequest {
+		t.Errorf("bad limit = %d, want 400", code)
+	}
+}
+
+func TestHandlerReloadError(t *testing.T) {
+	h := Handler(newProxy(), Options{Reload: func() error { return errors.New("bad policy") }})
+	if code, body := do(t, h, "POST", "/reload", ""); code != http.StatusUnprocessableEntity || body["error"] != "bad policy" {
+		t.Errorf("reload = %d %v", code, body)
+	}
+}
+
+func TestHandlerToken(t *testing.T) {
+	h := Handler(newProxy(), Options{Token: "s3cret"})
+	if code, _ := do(t, h, "GET", "/healthz", ""); code != http.StatusUnauthorized {
+		t.Errorf("no token = %d, want 401", code)
+	}
+	if code, _ := do(t, h, "GET", "/healthz", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("wrong token = %d, want 401", code)
+	}
+	if code, _ := do(t, h, "GET", "/healthz", "s3cret"); code != http.StatusOK {
+		t.Errorf("right token = %d, want 200", code)
+	}
+}
+
+func TestListen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	ln, needToken, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if needToken {
+		t.Error("unix socket should not need a token")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %o, want 600", perm)
+	}
+
+	if _, _, err := Listen("0.0.0.0:0"); err == nil {
+		t.Error("listening on all interfaces should be refused")
+	}
+	tcp, needToken, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp.Close()
+	if !needToken {
+		t.Error("TCP listener should need a token")
+	}
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchOptions controls how a network sink queues and delivers records.
+type BatchOptions struct {
+	// BufferSize is how many records may wait for delivery before new
+	// ones are dropped.
+	BufferSize int
+	// BatchSize and FlushInterval bound how long a record waits: a batch
+	// is sent when it is full or when the interval has passed.
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxRetries is how many times a failed batch is retried, with
+	// exponential backoff starting at RetryBackoff, before it is dropped.
+	// Zero means DefaultMaxRetries; a negative value disables retries.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration
+}
+
+// DefaultMaxRetries is how many times a failed batch is retried unless
+// BatchOptions says otherwise.
+const DefaultMaxRetries = 3
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.BufferSize <= 0 {
+		o.BufferSize = 10000
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = 5 * time.Second
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = DefaultMaxRetries
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 500 * time.Millisecond
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	return o
+}
+
+// batchSink queues records and delivers them in batches from a background
+// goroutine, so a slow or unreachable destination never delays Write.
+type batchSink struct {
+	*sinkStats
+	opts  BatchOptions
+	send  func(ctx context.Context, batch [][]byte) error
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+	// stop cancels an in-progress delivery when Close gives up waiting.
+	ctx  context.Context
+	stop context.CancelFunc
+}
+
+func newBatchSink(name string, opts BatchOptions, send func(context.Context, [][]byte) error) *batchSink {
+	opts = opts.withDefaults()
+	ctx, stop := context.WithCancel(context.Background())
+	s := &batchSink{
+		sinkStats: newSinkStats(name),
+		opts:      opts,
+		send:      send,
+		queue:     make(chan []byte, opts.BufferSize),
+		done:      make(chan struct{}),
+		ctx:       ctx,
+		stop:      stop,
+	}
+	go s.run()
+	return s
+}
+
+// Write queues record for delivery, dropping it if the queue is full.
+func (s *batchSink) Write(record []byte) error {
+	select {
+	case s.queue <- append([]byte(nil), record...):
+		return nil
+	default:
+		s.dropped()
+		return ErrSinkFull
+	}
+}
+
+// closeTimeout bounds how long Close waits for queued records to drain.
+const closeTimeout = 10 * time.Second
+
+// Close delivers what is queued, giving up after closeTimeout.
+func (s *batchSink) Close() error {
+	s.once.Do(func() { close(s.queue) })
+	select {
+	case <-s.done:
+	case <-time.After(closeTimeout):
+		s.stop()
+		<-s.done
+	}
+	return nil
+}
+
+func (s *batchSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	for {
+		select {
+		case rec, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) >= s.opts.BatchSize {
+				s.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+// flush sends batch, retrying with exponential backoff.
+func (s *batchSink) flush(batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+	backoff := s.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(s.ctx, s.opts.Timeout)
+		err := s.send(ctx, batch)
+		cancel()
+		if err == nil || attempt >= s.opts.MaxRetries || s.ctx.Err() != nil {
+			s.delivered(len(batch), err)
+			return
+		}
+		s.attemptFailed(err)
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			s.delivered(len(batch), err)
+			return
+		}
+		backoff *= 2
+	}
+}
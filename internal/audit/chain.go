@@ -0,0 +1,206 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Every record carries a sequence number and the SHA-256 of the previous
+// record's line, so removing, reordering or editing a record breaks the
+// chain. Because anyone can recompute the hashes, the chain head is
+// periodically signed in a checkpoint record; rewriting history then also
+// requires the signing key.
+
+// DefaultCheckpointEvery is the checkpoint interval used when a signing key
+// is set without an explicit interval.
+const DefaultCheckpointEvery = 100
+
+// SetSigner enables signed checkpoints: one is written after every records
+// (DefaultCheckpointEvery if every is zero) and at shutdown.
+func (l *Logger) SetSigner(key ed25519.PrivateKey, every int) {
+	if every <= 0 {
+		every = DefaultCheckpointEvery
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.signer = key
+	l.checkpointEvery = every
+}
+
+// Resume continues the hash chain after last, the final line already in the
+// log, so that a restarted proxy extends the existing chain rather than
+// starting a new one.
+func (l *Logger) Resume(last []byte) error {
+	last = bytes.TrimRight(last, "\n")
+	var rec struct {
+		Seq uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(last, &rec); err != nil {
+		return fmt.Errorf("parsing last audit record: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq = rec.Seq
+	l.prevHash = hashLine(last)
+	return nil
+}
+
+// Checkpoint writes a signed checkpoint now. It does nothing without a
+// signer.
+func (l *Logger) Checkpoint() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.signer != nil && !l.closed && l.hasRoom() {
+		l.writeCheckpoint()
+	}
+}
+
+// writeCheckpoint signs the current chain head. l.mu must be held.
+func (l *Logger) writeCheckpoint() {
+	seq := l.seq + 1
+	l.writeRecord(map[string]any{
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"event":     "checkpoint",
+		"key_id":    KeyID(l.signer.Public().(ed25519.PublicKey)),
+		"signature": base64.StdEncoding.EncodeToString(ed25519.Sign(l.signer, checkpointMessage(seq, l.prevHash))),
+	})
+}
+
+// checkpointMessage is what a checkpoint signs. prevHash commits to every
+// earlier record, so the signature covers the whole chain up to seq.
+func checkpointMessage(seq uint64, prevHash string) []byte {
+	return fmt.Appendf(nil, "constellation-audit-checkpoint:%d:%s", seq, prevHash)
+}
+
+func hashLine(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyID is a short fingerprint identifying a checkpoint signing key.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// LoadPrivateKey reads a PEM-encoded PKCS #8 Ed25519 private key.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", path)
+	}
+	return ed, nil
+}
+
+// LoadPublicKey reads a PEM-encoded PKIX Ed25519 public key.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 public key", path)
+	}
+	return ed, nil
+}
+
+// MarshalPrivateKey encodes key as PEM PKCS #8.
+func MarshalPrivateKey(key ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// MarshalPublicKey encodes key as PEM PKIX.
+func MarshalPublicKey(key ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s: no PEM %s block", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// LastRecord returns the final complete line of the audit log at path,
+// falling back to the newest rotated file when the log is missing or
+// empty. It returns nil if there is no earlier record.
+func LastRecord(path string) ([]byte, error) {
+	rotated, err := RotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	files := append(rotated, path)
+	for i := len(files) - 1; i >= 0; i-- {
+		last, err := lastLine(files[i])
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			return last, nil
+		}
+	}
+	return nil, nil
+}
+
+// lastLine returns the last line of a possibly gzipped file that parses
+// as JSON, skipping a record torn by a crash.
+func lastLine(name string) ([]byte, error) {
+	r, err := OpenLog(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var last []byte
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if json.Valid(scanner.Bytes()) {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return last, nil
+}
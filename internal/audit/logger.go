@@ -1,21 +1,151 @@
 package audit
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"sync"
 	"time"
 )
 
-// Logger writes structured JSON audit events.
+// Level controls how much detail the audit log records.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// ParseLevel parses a --log-level flag value.
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Logger writes structured JSON audit events to one or more sinks.
 type Logger struct {
-	mu     sync.Mutex
-	writer io.Writer
+	mu    sync.Mutex
+	sinks []Sink
+	level Level
+
+	// Hash chain state; see chain.go.
+	seq             uint64
+	prevHash        string
+	signer          ed25519.PrivateKey
+	checkpointEvery int
+
+	// Queue state; see queue.go. queue is nil when records are written
+	// synchronously.
+	queue    chan queued
+	overflow OverflowPolicy
+	drained  chan struct{}
+	closed   bool
+	dropped  uint64
+	rejected uint64
+	// lost counts records dropped since the last one written.
+	lost uint64
+
+	redactor *Redactor
+	// session is stamped on every record as session_id.
+	session string
+	// resultBody and resultBodyMax control tool_result bodies; see
+	// result.go.
+	resultBody    ResultBodyMode
+	resultBodyMax int
 }
 
-// New creates a Logger that writes to the given writer.
+// New creates a Logger that writes to the given writer at LevelInfo.
 func New(w io.Writer) *Logger {
-	return &Logger{writer: w}
+	return NewWithSinks(NewWriterSink("writer", w))
+}
+
+// NewWithSinks creates a Logger at LevelInfo that writes every record to
+// each of sinks.
+func NewWithSinks(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks, level: LevelInfo}
+}
+
+// Health reports the state of each sink.
+func (l *Logger) Health() []SinkHealth {
+	health := make([]SinkHealth, len(l.sinks))
+	for i, s := range l.sinks {
+		health[i] = s.Health()
+	}
+	return health
+}
+
+// Close drains the queue, then flushes and closes every sink. Records
+// logged after Close are discarded.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	if l.queue != nil {
+		close(l.queue)
+	}
+	l.mu.Unlock()
+	if l.drained != nil {
+		<-l.drained
+	}
+
+	var errs []error
+	for _, s := range l.sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// SetLevel changes the logger's level. At LevelDebug, tool call records
+// include the policy evaluation trace.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// SetSession stamps id on every subsequent record as session_id, so that
+// records from proxies sharing a log can be grouped.
+func (l *Logger) SetSession(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.session = id
+}
+
+// SetRedactor makes the logger redact tool call arguments and traces with
+// r, and scrub r's resolved secrets from every record.
+func (l *Logger) SetRedactor(r *Redactor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactor = r
+}
+
+func (l *Logger) getRedactor() *Redactor {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.redactor
+}
+
+// DebugEnabled reports whether debug detail should be recorded.
+func (l *Logger) DebugEnabled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level <= LevelDebug
 }
 
 // ToolCallEvent represents a tool invocation audit record.
@@ -27,10 +157,24 @@ type ToolCallEvent struct {
 	Rule       int            `json:"matched_rule"`
 	Reason     string         `json:"reason,omitempty"`
 	DurationMs int64          `json:"duration_ms,omitempty"`
+	// RequestID is the JSON-RPC id of the tools/call request, and
+	// CorrelationID identifies the call across every record about it.
+	RequestID     any    `json:"request_id,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// Trace is the policy evaluation trace, recorded at debug level.
+	Trace any `json:"trace,omitempty"`
 }
 
-// LogToolCall records a tool invocation event.
-func (l *Logger) LogToolCall(e ToolCallEvent) {
+// LogToolCall records a tool invocation event. It returns ErrQueueFull if
+// the record could not be queued under OverflowFailClosed; the caller
+// should then refuse the call.
+func (l *Logger) LogToolCall(e ToolCallEvent) error {
+	if r := l.getRedactor(); r != nil {
+		e.Arguments = r.Arguments(e.Arguments)
+		if e.Trace != nil {
+			e.Trace = r.Trace(e.Trace)
+		}
+	}
 	record := map[string]any{
 		"timestamp":    time.Now().UTC().Format(time.RFC3339),
 		"event":        "tool_call",
@@ -46,7 +190,37 @@ func (l *Logger) LogToolCall(e ToolCallEvent) {
 	if e.DurationMs > 0 {
 		record["duration_ms"] = e.DurationMs
 	}
-	l.write(record)
+	if e.RequestID != nil {
+		record["request_id"] = e.RequestID
+	}
+	if e.CorrelationID != "" {
+		record["correlation_id"] = e.CorrelationID
+	}
+	if e.Trace != nil {
+		record["trace"] = e.Trace
+	}
+	return l.write(record)
+}
+
+// SessionEvent describes the client that opened a session, taken from its
+// initialize request.
+type SessionEvent struct {
+	Server          string `json:"server"`
+	ClientName      string `json:"client_name,omitempty"`
+	ClientVersion   string `json:"client_version,omitempty"`
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+}
+
+// LogSession records the client's initialize information.
+func (l *Logger) LogSession(e SessionEvent) {
+	l.write(map[string]any{
+		"timestamp":        time.Now().UTC().Format(time.RFC3339),
+		"event":            "session",
+		"server":           e.Server,
+		"client_name":      e.ClientName,
+		"client_version":   e.ClientVersion,
+		"protocol_version": e.ProtocolVersion,
+	})
 }
 
 // LogStartup records a proxy startup event.
@@ -59,37 +233,79 @@ func (l *Logger) LogStartup(server, policyPath string) {
 	})
 }
 
-// LogShutdown records a proxy shutdown event.
+// LogPolicyReload records that the policy was reloaded while running;
+// hash identifies the policy now enforced.
+func (l *Logger) LogPolicyReload(server, policyPath, hash string) {
+	l.write(map[string]any{
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"event":       "policy_reload",
+		"server":      server,
+		"policy_file": policyPath,
+		"policy_hash": hash,
+	})
+}
+
+// LogShutdown records a proxy shutdown event with each sink's delivery
+// counts, followed by a checkpoint if signing is enabled so that
+// truncating the log is detectable.
 func (l *Logger) LogShutdown(server string) {
 	l.write(map[string]any{
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 		"event":     "shutdown",
 		"server":    server,
+		"sinks":     l.Health(),
 	})
+	l.Checkpoint()
 }
 
-func (l *Logger) write(record map[string]any) {
+// write encodes, chains and delivers a record. It returns ErrQueueFull if
+// the record was rejected under OverflowFailClosed.
+func (l *Logger) write(record map[string]any) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	data, err := json.Marshal(record)
-	if err != nil {
-		return
+	if l.closed {
+		return nil
+	}
+	if !l.hasRoom() {
+		l.lost++
+		if l.overflow == OverflowFailClosed {
+			l.rejected++
+			return ErrQueueFull
+		}
+		l.dropped++
+		return nil
+	}
+	if l.lost > 0 {
+		record["dropped"] = l.lost
+		l.lost = 0
+	}
+	if l.session != "" {
+		record["session_id"] = l.session
 	}
-	data = append(data, '\n')
-	l.writer.Write(data)
+	l.writeRecord(record)
+	if l.signer != nil && l.seq%uint64(l.checkpointEvery) == 0 && l.hasRoom() {
+		l.writeCheckpoint()
+	}
+	return nil
 }
 
-// RedactSecrets replaces argument values that correspond to secret references
-// with a redaction marker. Returns a new map; does not modify the original.
-func RedactSecrets(args map[string]any, secretRefs map[string]string) map[string]any {
-	redacted := make(map[string]any, len(args))
-	for k, v := range args {
-		redacted[k] = v
+// recordFields are the record fields the logger itself fills in, which
+// secret scrubbing leaves alone.
+var recordFields = []string{"timestamp", "event", "seq", "prev_hash", "session_id"}
+
+// writeRecord links record into the hash chain and delivers it. l.mu must
+// be held.
+func (l *Logger) writeRecord(record map[string]any) {
+	record["seq"] = l.seq + 1
+	record["prev_hash"] = l.prevHash
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
 	}
-	for envName, ref := range secretRefs {
-		if _, exists := redacted[envName]; exists {
-			redacted[envName] = "[REDACTED:" + ref + "]"
-		}
+	if l.redactor != nil {
+		data = l.redactor.ScrubSecrets(data, recordFields...)
 	}
-	return redacted
+	l.seq++
+	l.prevHash = hashLine(data)
+	l.enqueue(append(data, '\n'))
 }
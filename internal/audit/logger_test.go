@@ -83,16 +83,92 @@ func TestLogStartup(t *testing.T) {
 	}
 }
 
-func TestRedactSecrets(t *testing.T) {
-	refs := map[string]string{
-		"API_KEY": "vault:secret/myapp#api_key",
+func TestLogToolCallTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf)
+	if logger.DebugEnabled() {
+		t.Fatal("debug should be off by default")
+	}
+
+	level, err := ParseLevel("debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.SetLevel(level)
+	if !logger.DebugEnabled() {
+		t.Fatal("expected debug to be enabled")
+	}
+
+	logger.LogToolCall(ToolCallEvent{
+		Server:   "filesystem",
+		Tool:     "read_file",
+		Decision: "deny",
+		Rule:     -1,
+		Trace:    map[string]any{"fallthrough": "no rule names tool"},
+	})
+
+	var event map[string]any
+	if err := json.NewDecoder(&buf).Decode(&event); err != nil {
+		t.Fatalf("failed to decode log output: %v", err)
+	}
+	trace, ok := event["trace"].(map[string]any)
+	if !ok || trace["fallthrough"] != "no rule names tool" {
+		t.Errorf("trace = %v, want recorded trace", event["trace"])
 	}
-	args := map[string]any{
-		"key":  "supersecretvalue",
-		"name": "visible",
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
 	}
-	redacted := RedactSecrets(args, refs)
-	if redacted["name"] != "visible" {
-		t.Errorf("non-secret value was modified")
+}
+
+func TestSessionStampedOnRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf)
+	logger.SetSession("abc123")
+
+	logger.LogStartup("filesystem", "")
+	logger.LogSession(SessionEvent{Server: "filesystem", ClientName: "editor", ClientVersion: "1.2", ProtocolVersion: "2025-06-18"})
+	logger.LogToolCall(ToolCallEvent{Server: "filesystem", Tool: "read_file", Decision: "allow", RequestID: 7, CorrelationID: "abc123-1"})
+	logger.LogShutdown("filesystem")
+
+	dec := json.NewDecoder(&buf)
+	var events []map[string]any
+	for dec.More() {
+		var event map[string]any
+		if err := dec.Decode(&event); err != nil {
+			t.Fatalf("failed to decode log output: %v", err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d records, want 4", len(events))
+	}
+	for _, e := range events {
+		if e["session_id"] != "abc123" {
+			t.Errorf("%s record session_id = %v, want abc123", e["event"], e["session_id"])
+		}
+	}
+	if s := events[1]; s["client_name"] != "editor" || s["client_version"] != "1.2" || s["protocol_version"] != "2025-06-18" {
+		t.Errorf("session record = %v", s)
+	}
+	if c := events[2]; c["request_id"] != 7.0 || c["correlation_id"] != "abc123-1" {
+		t.Errorf("tool_call record = %v", c)
+	}
+
+	rec, err := ParseRecord([]byte(mustMarshal(t, events[2])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.SessionID != "abc123" || rec.CorrelationID != "abc123-1" {
+		t.Errorf("parsed record session %q correlation %q", rec.SessionID, rec.CorrelationID)
+	}
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
 	}
+	return string(data)
 }
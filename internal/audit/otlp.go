@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewOTLPSink returns a sink that exports records as OpenTelemetry log
+// records using OTLP/HTTP with JSON encoding. opts.URL is the collector
+// endpoint, e.g. http://localhost:4318; /v1/logs is appended unless the
+// URL already ends with it.
+func NewOTLPSink(opts HTTPOptions, batch BatchOptions) Sink {
+	if u, err := url.Parse(opts.URL); err == nil && !strings.HasSuffix(u.Path, "/v1/logs") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/logs"
+		opts.URL = u.String()
+	}
+	return newBatchSink("otlp "+safeURL(opts.URL), batch, func(ctx context.Context, records [][]byte) error {
+		body, err := json.Marshal(otlpRequest(records))
+		if err != nil {
+			return err
+		}
+		return post(ctx, opts, body)
+	})
+}
+
+// The types below are the subset of ExportLogsServiceRequest we send.
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string     `json:"timeUnixNano"`
+	SeverityNumber int        `json:"severityNumber"`
+	SeverityText   string     `json:"severityText"`
+	Body           otlpValue  `json:"body"`
+	Attributes     []otlpAttr `json:"attributes,omitempty"`
+}
+
+// otlpAttrKeys are record fields copied into log record attributes so that
+// collectors can filter on them without parsing the body.
+var otlpAttrKeys = []string{"event", "server", "tool", "decision"}
+
+func otlpRequest(records [][]byte) map[string]any {
+	logs := make([]otlpLogRecord, 0, len(records))
+	for _, rec := range records {
+		rec = bytes.TrimRight(rec, "\n")
+		var fields map[string]any
+		json.Unmarshal(rec, &fields)
+
+		ts := time.Now()
+		if s, ok := fields["timestamp"].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				ts = t
+			}
+		}
+		lr := otlpLogRecord{
+			TimeUnixNano:   strconv.FormatInt(ts.UnixNano(), 10),
+			SeverityNumber: 9,
+			SeverityText:   "INFO",
+			Body:           otlpValue{StringValue: string(rec)},
+		}
+		if fields["decision"] == "deny" {
+			lr.SeverityNumber, lr.SeverityText = 13, "WARN"
+		}
+		for _, key := range otlpAttrKeys {
+			if v, ok := fields[key].(string); ok {
+				lr.Attributes = append(lr.Attributes, otlpAttr{Key: "constellation." + key, Value: otlpValue{StringValue: v}})
+			}
+		}
+		logs = append(logs, lr)
+	}
+	return map[string]any{
+		"resourceLogs": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []otlpAttr{{Key: "service.name", Value: otlpValue{StringValue: "constellation"}}},
+			},
+			"scopeLogs": []any{map[string]any{
+				"scope":      map[string]any{"name": "constellation.audit"},
+				"logRecords": logs,
+			}},
+		}},
+	}
+}
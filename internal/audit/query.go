@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Filter selects audit records. Zero fields match everything.
+type Filter struct {
+	// Event is the record type, e.g. "tool_call".
+	Event    string
+	Session  string
+	Server   string
+	Decision string
+	// Tool is a glob pattern matched against the tool name.
+	Tool string
+	// Since and Until bound the record timestamp, inclusive.
+	Since, Until time.Time
+	// Args maps argument names, or dotted paths into nested arguments, to
+	// glob patterns their values must match. Non-string values are matched
+	// in their JSON form.
+	Args map[string]string
+}
+
+// Validate checks the filter's glob patterns.
+func (f Filter) Validate() error {
+	if f.Tool != "" && !doublestar.ValidatePattern(f.Tool) {
+		return fmt.Errorf("invalid tool pattern %q", f.Tool)
+	}
+	for key, pattern := range f.Args {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid pattern %q for argument %s", pattern, key)
+		}
+	}
+	return nil
+}
+
+// Match reports whether rec satisfies every condition in f.
+func (f Filter) Match(rec Record) bool {
+	switch {
+	case f.Event != "" && rec.Event != f.Event,
+		f.Session != "" && rec.SessionID != f.Session,
+		f.Server != "" && rec.Server != f.Server,
+		f.Decision != "" && rec.Decision != f.Decision,
+		!f.Since.IsZero() && rec.Timestamp.Before(f.Since),
+		!f.Until.IsZero() && rec.Timestamp.After(f.Until):
+		return false
+	}
+	if f.Tool != "" {
+		if ok, _ := doublestar.Match(f.Tool, rec.Tool); !ok {
+			return false
+		}
+	}
+	for key, pattern := range f.Args {
+		value, ok := argValue(rec.Arguments, key)
+		if !ok {
+			return false
+		}
+		if ok, _ := doublestar.Match(pattern, value); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// argValue looks up a dotted path in args and renders the value as a
+// string.
+func argValue(args map[string]any, key string) (string, bool) {
+	var v any = args
+	for _, part := range strings.Split(key, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if v, ok = m[part]; !ok {
+			return "", false
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Follow reads records appended to the log at path, starting at byte
+// offset from, and calls fn for each until ctx is cancelled or fn returns
+// an error. It polls every interval and follows the log across rotation
+// and truncation: when path is replaced, the rest of the old file is read
+// before the new one is opened from its start.
+func Follow(ctx context.Context, path string, from int64, interval time.Duration, fn func(Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		return err
+	}
+	offset := from
+	r := bufio.NewReader(f)
+	var partial []byte
+
+	for {
+		line, err := r.ReadBytes('\n')
+		offset += int64(len(line))
+		if err == nil {
+			line = append(partial, line...)
+			partial = nil
+			if rec, perr := ParseRecord(bytes.TrimRight(line, "\n")); perr == nil {
+				if err := fn(rec); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		// A line without its newline yet; keep it until the rest arrives.
+		partial = append(partial, line...)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+
+		cur, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		next, err := os.Stat(path)
+		switch {
+		case err == nil && !os.SameFile(cur, next):
+			// Rotated: finish the old file, then switch.
+			if rest, _ := io.ReadAll(r); len(rest) > 0 {
+				for _, line := range bytes.Split(append(partial, rest...), []byte("\n")) {
+					if rec, perr := ParseRecord(line); perr == nil {
+						if err := fn(rec); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			nf, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			f.Close()
+			f, r, offset, partial = nf, bufio.NewReader(nf), 0, nil
+		case cur.Size() < offset:
+			// Truncated in place.
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			r.Reset(f)
+			offset, partial = 0, nil
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rec := Record{
+		Timestamp: ts,
+		Event:     "tool_call",
+		ToolCallEvent: ToolCallEvent{
+			Server:    "fs",
+			Tool:      "read_file",
+			Decision:  "deny",
+			Arguments: map[string]any{"path": "/etc/passwd", "opts": map[string]any{"depth": 2.0}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"server", Filter{Server: "fs"}, true},
+		{"other server", Filter{Server: "git"}, false},
+		{"tool glob", Filter{Tool: "read_*"}, true},
+		{"decision", Filter{Decision: "allow"}, false},
+		{"since", Filter{Since: ts.Add(-time.Minute)}, true},
+		{"until before", Filter{Until: ts.Add(-time.Minute)}, false},
+		{"arg glob", Filter{Args: map[string]string{"path": "/etc/**"}}, true},
+		{"arg mismatch", Filter{Args: map[string]string{"path": "/home/**"}}, false},
+		{"nested arg", Filter{Args: map[string]string{"opts.depth": "2"}}, true},
+		{"missing arg", Filter{Args: map[string]string{"mode": "*"}}, false},
+		{"event", Filter{Event: "startup"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(rec); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFilesAcrossRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := OpenRotatingFile(path, RotateOptions{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := New(f)
+	for i := 0; i < 6; i++ {
+		logger.LogToolCall(ToolCallEvent{Server: "fs", Tool: fmt.Sprintf("t%d", i), Decision: "allow"})
+		if i%2 == 1 {
+			if err := f.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(2 * time.Millisecond) // distinct rotated names
+		}
+	}
+	f.Close()
+
+	files, err := LogFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tools []string
+	if err := ReadFiles(files, func(rec Record) error {
+		tools = append(tools, rec.Tool)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tools) != "[t0 t1 t2 t3 t4 t5]" {
+		t.Errorf("read %v from %v, want t0..t5 in order", tools, files)
+	}
+}
+
+func TestFollowAcrossRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := OpenRotatingFile(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	logger := New(f)
+	logger.LogToolCall(ToolCallEvent{Tool: "before"})
+	info, _ := os.Stat(path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, path, info.Size(), 5*time.Millisecond, func(rec Record) error {
+			got <- rec.Tool
+			if rec.Tool == "after" {
+				return errStop
+			}
+			return nil
+		})
+	}()
+
+	logger.LogToolCall(ToolCallEvent{Tool: "one"})
+	time.Sleep(20 * time.Millisecond)
+	logger.LogToolCall(ToolCallEvent{Tool: "two"})
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	logger.LogToolCall(ToolCallEvent{Tool: "after"})
+
+	if err := <-done; !errors.Is(err, errStop) {
+		t.Fatalf("Follow() = %v", err)
+	}
+	close(got)
+	var tools []string
+	for tool := range got {
+		tools = append(tools, tool)
+	}
+	if fmt.Sprint(tools) != "[one two after]" {
+		t.Errorf("followed %v, want [one two after]", tools)
+	}
+}
+
+var errStop = errors.New("stop")
+
+func TestStats(t *testing.T) {
+	// Records shaped like the proxy writes them: the call's duration_ms is
+	// the policy evaluation time, and the upstream latency is on the
+	// tool_result that shares its correlation ID.
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		id := fmt.Sprintf("c%d", i)
+		if i > 7 {
+			lines = append(lines, fmt.Sprintf(`{"event":"tool_call","server":"fs","tool":"read","decision":"deny","correlation_id":%q}`, id))
+			continue
+		}
+		lines = append(lines,
+			fmt.Sprintf(`{"event":"tool_call","server":"fs","tool":"read","decision":"allow","correlation_id":%q}`, id),
+			fmt.Sprintf(`{"event":"tool_result","server":"fs","tool":"read","is_error":false,"latency_ms":%d.5,"correlation_id":%q}`, i, id))
+	}
+	lines = append(lines,
+		`{"event":"tool_call","server":"fs","tool":"write","decision":"deny","correlation_id":"w1"}`,
+		`{"event":"tool_result","server":"fs","tool":"read","is_error":false,"latency_ms":500,"correlation_id":"unknown"}`,
+		`{"event":"startup"}`)
+
+	c := NewStatsCollector()
+	for _, line := range lines {
+		rec, err := ParseRecord([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Add(rec)
+	}
+
+	s := c.Stats(1)
+	if s.Calls != 11 || s.Denied != 4 {
+		t.Errorf("Calls, Denied = %d, %d, want 11, 4", s.Calls, s.Denied)
+	}
+	if len(s.Tools) != 1 || s.Tools[0].Tool != "read" {
+		t.Fatalf("top tools = %+v, want read only", s.Tools)
+	}
+	read := s.Tools[0]
+	if read.DenyRate != 0.3 {
+		t.Errorf("deny rate = %v, want 0.3", read.DenyRate)
+	}
+	if want := (Percentiles{P50: 4.5, P90: 7.5, P99: 7.5, Max: 7.5}); read.Latency != want {
+		t.Errorf("latency = %+v, want %+v", read.Latency, want)
+	}
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OverflowPolicy decides what happens to a record when the queue between
+// the proxy and the sinks is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the caller wait for room, so no record is lost
+	// but a stalled sink eventually stalls tool calls.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop discards the record and counts it. The next record
+	// written carries the number dropped before it.
+	OverflowDrop
+	// OverflowFailClosed discards the record and returns ErrQueueFull, so
+	// that the proxy denies calls it cannot audit.
+	OverflowFailClosed
+)
+
+// ParseOverflowPolicy parses an audit.overflow config value.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch s {
+	case "block", "":
+		return OverflowBlock, nil
+	case "drop":
+		return OverflowDrop, nil
+	case "fail_closed":
+		return OverflowFailClosed, nil
+	}
+	return OverflowBlock, fmt.Errorf("unknown audit overflow policy %q", s)
+}
+
+// ErrQueueFull is returned for a record rejected under OverflowFailClosed.
+var ErrQueueFull = errors.New("audit queue full")
+
+// DefaultQueueSize is the queue capacity used when none is configured.
+const DefaultQueueSize = 1024
+
+// QueueStats describes the audit queue.
+type QueueStats struct {
+	Len, Cap int
+	// Dropped counts records discarded under OverflowDrop; Rejected counts
+	// records refused under OverflowFailClosed.
+	Dropped, Rejected uint64
+}
+
+// queued is one entry in the audit queue: an encoded record, or a flush
+// marker closed once everything before it has been delivered.
+type queued struct {
+	data    []byte
+	flushed chan struct{}
+}
+
+// StartQueue moves delivery to the sinks onto a background goroutine fed by
+// a queue of size records (DefaultQueueSize if size is zero). Records are
+// still encoded and chained synchronously, so they reach every sink in the
+// order they were logged. Call Close to drain the queue.
+func (l *Logger) StartQueue(size int, overflow OverflowPolicy) {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.queue != nil {
+		return
+	}
+	l.queue = make(chan queued, size)
+	l.overflow = overflow
+	l.drained = make(chan struct{})
+	go l.deliver()
+}
+
+func (l *Logger) deliver() {
+	defer close(l.drained)
+	for q := range l.queue {
+		if q.flushed != nil {
+			close(q.flushed)
+			continue
+		}
+		l.writeSinks(q.data)
+	}
+}
+
+// writeSinks hands data to every sink. Each sink records its own failures;
+// one failing sink must not stop the others.
+func (l *Logger) writeSinks(data []byte) {
+	for _, s := range l.sinks {
+		s.Write(data)
+	}
+}
+
+// Flush waits until every record logged so far has been handed to the
+// sinks.
+func (l *Logger) Flush() {
+	l.mu.Lock()
+	if l.queue == nil || l.closed {
+		l.mu.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	l.queue <- queued{flushed: ch}
+	l.mu.Unlock()
+	<-ch
+}
+
+// QueueStats reports the queue's occupancy and losses.
+func (l *Logger) QueueStats() QueueStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return QueueStats{Len: len(l.queue), Cap: cap(l.queue), Dropped: l.dropped, Rejected: l.rejected}
+}
+
+// hasRoom reports whether a record can be queued without blocking, or
+// whether blocking is the configured policy. l.mu must be held.
+func (l *Logger) hasRoom() bool {
+	return l.queue == nil || l.overflow == OverflowBlock || len(l.queue) < cap(l.queue)
+}
+
+// enqueue delivers data directly or through the queue. l.mu must be held;
+// since only writers holding it send, a prior hasRoom check guarantees
+// the send will not block unless the policy is OverflowBlock.
+func (l *Logger) enqueue(data []byte) {
+	if l.queue == nil {
+		l.writeSinks(data)
+		return
+	}
+	l.queue <- queued{data: data}
+}
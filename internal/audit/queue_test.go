@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gateSink holds every Write until the gate is opened, simulating a
+// stalled destination.
+type gateSink struct {
+	*sinkStats
+	gate chan struct{}
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func newGateSink() *gateSink {
+	return &gateSink{sinkStats: newSinkStats("gate"), gate: make(chan struct{})}
+}
+
+func (s *gateSink) Write(p []byte) error {
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(p)
+	s.delivered(1, nil)
+	return nil
+}
+
+func (s *gateSink) Close() error { return nil }
+
+func (s *gateSink) lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(s.buf.String(), "\n"), "\n")
+}
+
+func TestQueuePreservesOrder(t *testing.T) {
+	var a, b bytes.Buffer
+	logger := NewWithSinks(NewWriterSink("a", &a), NewWriterSink("b", &b))
+	logger.StartQueue(4, OverflowBlock)
+
+	// Concurrent writers: each writer's records must stay in its own order
+	// and the combined stream must be a single unbroken chain.
+	const writers, perWriter = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				logger.LogToolCall(ToolCallEvent{Server: "fs", Tool: "t", Decision: "allow", Arguments: map[string]any{"w": w, "i": i}})
+			}
+		}()
+	}
+	wg.Wait()
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.String() != b.String() {
+		t.Fatal("sinks received records in different orders")
+	}
+	lines := strings.Split(strings.TrimSuffix(a.String(), "\n"), "\n")
+	if len(lines) != writers*perWriter {
+		t.Fatalf("got %d records, want %d", len(lines), writers*perWriter)
+	}
+	next := map[float64]float64{}
+	for n, line := range lines {
+		var rec struct {
+			Seq  int                `json:"seq"`
+			Args map[string]float64 `json:"arguments"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Seq != n+1 {
+			t.Fatalf("record %d has seq %d", n, rec.Seq)
+		}
+		w, i := rec.Args["w"], rec.Args["i"]
+		if i != next[w] {
+			t.Fatalf("writer %v: record %v arrived when %v was expected", w, i, next[w])
+		}
+		next[w]++
+	}
+	if res, err := Verify(nil, writeLines(t, lines)); err != nil || !res.OK() {
+		t.Fatalf("Verify() = %v, %v", res.Problems, err)
+	}
+}
+
+func TestQueueDropPolicy(t *testing.T) {
+	sink := newGateSink()
+	logger := NewWithSinks(sink)
+	logger.StartQueue(2, OverflowDrop)
+
+	// The delivery goroutine takes one record and blocks on the gate; two
+	// more fill the queue; the rest are dropped without blocking.
+	for i := 0; i < 10; i++ {
+		if err := logger.LogToolCall(ToolCallEvent{Tool: "t", Decision: "allow"}); err != nil {
+			t.Fatalf("LogToolCall() = %v, want nil under drop policy", err)
+		}
+	}
+	stats := logger.QueueStats()
+	if stats.Dropped < 7 {
+		t.Errorf("Dropped = %d, want at least 7", stats.Dropped)
+	}
+	close(sink.gate)
+	logger.Flush()
+
+	// The next record to get through reports the loss.
+	logger.LogToolCall(ToolCallEvent{Tool: "after", Decision: "allow"})
+	logger.Close()
+
+	lines := sink.lines()
+	var last map[string]any
+	json.Unmarshal([]byte(lines[len(lines)-1]), &last)
+	if last["tool"] != "after" || last["dropped"] != float64(stats.Dropped) {
+		t.Errorf("last record = %v, want tool after with dropped = %d", last, stats.Dropped)
+	}
+	// Dropped records never entered the chain, so it is still intact.
+	if res, err := Verify(nil, writeLines(t, lines)); err != nil || !res.OK() {
+		t.Fatalf("Verify() = %v, %v", res.Problems, err)
+	}
+}
+
+func TestQueueFailClosed(t *testing.T) {
+	sink := newGateSink()
+	logger := NewWithSinks(sink)
+	logger.StartQueue(1, OverflowFailClosed)
+
+	var rejected int
+	for i := 0; i < 5; i++ {
+		err := logger.LogToolCall(ToolCallEvent{Tool: "t", Decision: "allow"})
+		if errors.Is(err, ErrQueueFull) {
+			rejected++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rejected == 0 || logger.QueueStats().Rejected != uint64(rejected) {
+		t.Errorf("rejected %d calls, stats = %+v", rejected, logger.QueueStats())
+	}
+	close(sink.gate)
+	logger.Close()
+}
+
+func TestCloseFlushesQueue(t *testing.T) {
+	sink := newGateSink()
+	logger := NewWithSinks(sink)
+	logger.StartQueue(100, OverflowBlock)
+	for i := 0; i < 20; i++ {
+		logger.LogToolCall(ToolCallEvent{Tool: "t", Decision: "allow"})
+	}
+	logger.LogShutdown("fs")
+	close(sink.gate)
+	logger.Close()
+
+	lines := sink.lines()
+	if len(lines) != 21 || !strings.Contains(lines[20], `"event":"shutdown"`) {
+		t.Fatalf("got %d records after Close, want 21 ending in shutdown", len(lines))
+	}
+	// Records logged after Close are discarded rather than panicking.
+	logger.LogToolCall(ToolCallEvent{Tool: "late"})
+}
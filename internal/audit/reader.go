@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Record is one decoded audit log line. The ToolCallEvent fields are only
+// populated for tool_call events, apart from Server, Tool and the request
+// and correlation IDs, which tool_result events share.
+type Record struct {
+	Timestamp time.Time
+	Event     string
+	SessionID string
+	ToolCallEvent
+	// IsError, ErrorCode and LatencyMs are populated for tool_result
+	// events.
+	IsError   bool
+	ErrorCode int
+	LatencyMs float64
+	// Raw is the record's original line.
+	Raw []byte
+}
+
+// ParseRecord decodes a single JSONL audit line.
+func ParseRecord(line []byte) (Record, error) {
+	var rec struct {
+		Timestamp string  `json:"timestamp"`
+		Event     string  `json:"event"`
+		SessionID string  `json:"session_id"`
+		IsError   bool    `json:"is_error"`
+		ErrorCode int     `json:"error_code"`
+		LatencyMs float64 `json:"latency_ms"`
+		ToolCallEvent
+	}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return Record{}, err
+	}
+	ts, _ := time.Parse(time.RFC3339Nano, rec.Timestamp)
+	raw := append([]byte(nil), line...)
+	return Record{
+		Timestamp:     ts,
+		Event:         rec.Event,
+		SessionID:     rec.SessionID,
+		ToolCallEvent: rec.ToolCallEvent,
+		IsError:       rec.IsError,
+		ErrorCode:     rec.ErrorCode,
+		LatencyMs:     rec.LatencyMs,
+		Raw:           raw,
+	}, nil
+}
+
+// ReadRecords calls fn for every well-formed record in r, in order. Lines
+// that are not valid JSON, such as a record cut short by a crash, are
+// skipped. Reading stops at the first error returned by fn.
+func ReadRecords(r io.Reader, fn func(Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		rec, err := ParseRecord(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// LogFiles returns an audit log's rotated files, oldest first, followed by
+// the log itself if it exists.
+func LogFiles(path string) ([]string, error) {
+	files, err := RotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// ReadFiles calls fn for every well-formed record in files, in order,
+// decompressing gzipped files.
+func ReadFiles(files []string, fn func(Record) error) error {
+	for _, name := range files {
+		r, err := OpenLog(name)
+		if err != nil {
+			return err
+		}
+		err = ReadRecords(r, fn)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// OpenLog opens an audit log file for reading, decompressing rotated files
+// that end in .gz.
+func OpenLog(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: zr, file: f}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
@@ -0,0 +1,358 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RedactOptions configures what a Redactor removes from audit records.
+type RedactOptions struct {
+	// Keys are glob patterns matched case-insensitively against argument
+	// names and their dotted paths, e.g. "*password*" or "headers.authorization".
+	// A matching argument's whole value is redacted.
+	Keys []string
+	// Values are regular expressions; matching parts of string values are
+	// redacted wherever they appear.
+	Values []string
+	// DetectSecrets redacts well-known credential formats such as cloud
+	// access keys, API tokens, JWTs and PEM private keys.
+	DetectSecrets bool
+	// MaxValueLength truncates longer string arguments. Zero means no limit.
+	MaxValueLength int
+	// Hash appends a short digest of each redacted or truncated value so
+	// that records can be correlated without revealing it. With HashSalt
+	// set the digest is an HMAC, which resists guessing short values.
+	Hash     bool
+	HashSalt string
+}
+
+// secretFormats are the credential formats recognised by DetectSecrets.
+var secretFormats = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"stripe_key", regexp.MustCompile(`\b[rs]k_(?:live|test)_[A-Za-z0-9]{16,}\b`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"vault_token", regexp.MustCompile(`\bhv[sbr]\.[A-Za-z0-9_-]{20,}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{"bearer_token", regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{8,}=*`)},
+}
+
+// minSecretLength is the shortest resolved secret scrubbed from records;
+// shorter values would match too much unrelated text.
+const minSecretLength = 4
+
+// Redactor removes sensitive values from audit records.
+type Redactor struct {
+	opts   RedactOptions
+	keys   []string
+	values []*regexp.Regexp
+
+	mu      sync.RWMutex
+	secrets []namedSecret
+}
+
+type namedSecret struct {
+	name, value string
+	// encoded is the value as it appears inside a JSON string.
+	encoded string
+}
+
+// NewRedactor compiles opts.
+func NewRedactor(opts RedactOptions) (*Redactor, error) {
+	r := &Redactor{opts: opts}
+	for _, k := range opts.Keys {
+		k = strings.ToLower(k)
+		if _, err := path.Match(k, ""); err != nil {
+			return nil, fmt.Errorf("redact key pattern %q: %w", k, err)
+		}
+		r.keys = append(r.keys, k)
+	}
+	for _, v := range opts.Values {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("redact value pattern %q: %w", v, err)
+		}
+		r.values = append(r.values, re)
+	}
+	return r, nil
+}
+
+// AddSecrets registers resolved secret values, keyed by the name reported
+// in their place, e.g. the environment variable they were injected as.
+// They are scrubbed from every record, not only from arguments.
+func (r *Redactor) AddSecrets(secrets map[string]string) {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		value := secrets[name]
+		if len(value) < minSecretLength {
+			continue
+		}
+		enc, _ := json.Marshal(value)
+		r.secrets = append(r.secrets, namedSecret{name: name, value: value, encoded: string(enc[1 : len(enc)-1])})
+	}
+	// Replace longer secrets first so one that contains another is not
+	// left partly visible.
+	sort.SliceStable(r.secrets, func(i, j int) bool { return len(r.secrets[i].value) > len(r.secrets[j].value) })
+}
+
+// Arguments returns a redacted copy of tool call arguments.
+func (r *Redactor) Arguments(args map[string]any) map[string]any {
+	if args == nil {
+		return nil
+	}
+	return r.walk("", args).(map[string]any)
+}
+
+// Trace returns a redacted copy of a policy evaluation trace. The trace is
+// converted to its JSON form; clauses, which carry an argument "key" and
+// its "value", have the value redacted as that argument would be.
+func (r *Redactor) Trace(trace any) any {
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	return r.trace(v)
+}
+
+func (r *Redactor) trace(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = r.trace(item)
+		}
+		if key, ok := v["key"].(string); ok {
+			if value, ok := v["value"]; ok {
+				out["value"] = r.walk(key, value)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = r.trace(item)
+		}
+		return out
+	case string:
+		return r.scrub(v)
+	}
+	return v
+}
+
+// walk redacts v, found at the dotted argument path p.
+func (r *Redactor) walk(p string, v any) any {
+	if p != "" && r.matchKey(p) {
+		return r.marker("", v)
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = r.walk(join(p, k), item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = r.walk(p, item)
+		}
+		return out
+	case string:
+		return r.truncate(r.scrub(v))
+	}
+	return v
+}
+
+func join(p, k string) string {
+	if p == "" {
+		return k
+	}
+	return p + "." + k
+}
+
+// matchKey reports whether the last element or the whole of a dotted path
+// matches a key pattern.
+func (r *Redactor) matchKey(p string) bool {
+	p = strings.ToLower(p)
+	name := p[strings.LastIndex(p, ".")+1:]
+	for _, k := range r.keys {
+		if ok, _ := path.Match(k, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(k, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// scrub redacts resolved secrets, value patterns and detected credential
+// formats within s.
+func (r *Redactor) scrub(s string) string {
+	s = r.replaceSecrets(s)
+	for _, re := range r.values {
+		s = re.ReplaceAllStringFunc(s, func(m string) string { return r.marker("", m) })
+	}
+	if r.opts.DetectSecrets {
+		for _, f := range secretFormats {
+			s = f.re.ReplaceAllStringFunc(s, func(m string) string { return r.marker(f.name, m) })
+		}
+	}
+	return s
+}
+
+// replaceSecrets replaces each resolved secret in s with a marker naming
+// it.
+func (r *Redactor) replaceSecrets(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, sec := range r.secrets {
+		if strings.Contains(s, sec.value) {
+			s = strings.ReplaceAll(s, sec.value, "[REDACTED:"+sec.name+"]")
+		}
+	}
+	return s
+}
+
+// truncate shortens s to MaxValueLength bytes, on a rune boundary.
+func (r *Redactor) truncate(s string) string {
+	max := r.opts.MaxValueLength
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	cut := truncateUTF8(s, max)
+	suffix := fmt.Sprintf("...[truncated %d bytes", len(s)-len(cut))
+	if r.opts.Hash {
+		suffix += " " + r.digest(s)
+	}
+	return cut + suffix + "]"
+}
+
+// truncateUTF8 cuts s to at most max bytes without splitting a rune.
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
+
+// marker is the text that replaces a redacted value, labelled with the
+// secret format if one was detected.
+func (r *Redactor) marker(label string, v any) string {
+	m := "[REDACTED"
+	if label != "" {
+		m += ":" + label
+	}
+	if r.opts.Hash {
+		s, ok := v.(string)
+		if !ok {
+			data, _ := json.Marshal(v)
+			s = string(data)
+		}
+		m += " " + r.digest(s)
+	}
+	return m + "]"
+}
+
+func (r *Redactor) digest(s string) string {
+	var sum []byte
+	if r.opts.HashSalt != "" {
+		mac := hmac.New(sha256.New, []byte(r.opts.HashSalt))
+		mac.Write([]byte(s))
+		sum = mac.Sum(nil)
+	} else {
+		h := sha256.Sum256([]byte(s))
+		sum = h[:]
+	}
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// ScrubSecrets removes resolved secrets from the string values of
+// JSON-encoded data; object keys, numbers and the top-level fields named
+// in keep are left alone. Data containing a secret is re-encoded, so its
+// object keys come out sorted. The logger applies it to every record,
+// catching any secret that reached a field other than the arguments and
+// trace.
+func (r *Redactor) ScrubSecrets(data []byte, keep ...string) []byte {
+	r.mu.RLock()
+	found := false
+	for _, sec := range r.secrets {
+		if bytes.Contains(data, []byte(sec.encoded)) {
+			found = true
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if !found {
+		return data
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return data
+	}
+	if m, ok := v.(map[string]any); ok {
+		for k, item := range m {
+			if !slices.Contains(keep, k) {
+				m[k] = r.scrubValues(item)
+			}
+		}
+	} else {
+		v = r.scrubValues(v)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// scrubValues replaces resolved secrets in the strings within v.
+func (r *Redactor) scrubValues(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = r.scrubValues(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = r.scrubValues(item)
+		}
+	case string:
+		return r.replaceSecrets(v)
+	}
+	return v
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ResultBodyMode decides how much of a tool result body is kept in its
+// tool_result record.
+type ResultBodyMode int
+
+const (
+	// ResultBodyNone records only the result's shape: status, content
+	// types and sizes.
+	ResultBodyNone ResultBodyMode = iota
+	// ResultBodyTruncate records the body, with secrets scrubbed, cut to
+	// the configured length.
+	ResultBodyTruncate
+	// ResultBodyHash records a SHA-256 digest of the body, so a retained
+	// response can later be matched to its call.
+	ResultBodyHash
+)
+
+// ParseResultBodyMode parses an audit.result_body config value.
+func ParseResultBodyMode(s string) (ResultBodyMode, error) {
+	switch s {
+	case "none", "":
+		return ResultBodyNone, nil
+	case "truncate":
+		return ResultBodyTruncate, nil
+	case "hash":
+		return ResultBodyHash, nil
+	}
+	return ResultBodyNone, fmt.Errorf("unknown audit result_body mode %q", s)
+}
+
+// DefaultResultBodyMax is the length truncated result bodies are cut to
+// when none is configured.
+const DefaultResultBodyMax = 4096
+
+// SetResultBody sets how result bodies are recorded; max applies to
+// ResultBodyTruncate, with zero meaning DefaultResultBodyMax.
+func (l *Logger) SetResultBody(mode ResultBodyMode, max int) {
+	if max <= 0 {
+		max = DefaultResultBodyMax
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resultBody, l.resultBodyMax = mode, max
+}
+
+// ContentSummary describes one item of a tool result's content.
+type ContentSummary struct {
+	Type  string `json:"type"`
+	Bytes int    `json:"bytes"`
+}
+
+// ToolResultEvent records the outcome of a tool call that reached the
+// server.
+type ToolResultEvent struct {
+	Server        string
+	Tool          string
+	RequestID     any
+	CorrelationID string
+	// IsError is the result's isError flag: the tool ran and failed.
+	IsError bool
+	// ErrorCode and ErrorMessage are set for a JSON-RPC error response.
+	ErrorCode    int
+	ErrorMessage string
+	Content      []ContentSummary
+	// Bytes is the size of the response message.
+	Bytes int
+	// Latency is the time from forwarding the request to the response.
+	Latency time.Duration
+	// Body is the encoded result, recorded according to the logger's
+	// ResultBodyMode.
+	Body json.RawMessage
+}
+
+// LogToolResult records the outcome of a tool call.
+func (l *Logger) LogToolResult(e ToolResultEvent) {
+	l.mu.Lock()
+	mode, max := l.resultBody, l.resultBodyMax
+	l.mu.Unlock()
+
+	record := map[string]any{
+		"timestamp":  time.Now().UTC().Format(time.RFC3339),
+		"event":      "tool_result",
+		"server":     e.Server,
+		"tool":       e.Tool,
+		"is_error":   e.IsError,
+		"bytes":      e.Bytes,
+		"latency_ms": math.Round(float64(e.Latency.Microseconds())) / 1000,
+	}
+	if e.RequestID != nil {
+		record["request_id"] = e.RequestID
+	}
+	if e.CorrelationID != "" {
+		record["correlation_id"] = e.CorrelationID
+	}
+	if e.ErrorCode != 0 || e.ErrorMessage != "" {
+		record["error_code"] = e.ErrorCode
+		record["error_message"] = e.ErrorMessage
+	}
+	if len(e.Content) > 0 {
+		record["content"] = e.Content
+	}
+	switch {
+	case len(e.Body) == 0:
+	case mode == ResultBodyHash:
+		sum := sha256.Sum256(e.Body)
+		record["body_sha256"] = hex.EncodeToString(sum[:])
+	case mode == ResultBodyTruncate:
+		body := string(e.Body)
+		if r := l.getRedactor(); r != nil {
+			body = r.scrub(body)
+		}
+		if len(body) > max {
+			record["body_truncated"] = true
+			body = truncateUTF8(body, max)
+		}
+		record["body"] = body
+	}
+	l.write(record)
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func logResult(t *testing.T, configure func(*Logger), e ToolResultEvent) map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := New(&buf)
+	if configure != nil {
+		configure(logger)
+	}
+	logger.LogToolResult(e)
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("decoding record: %v", err)
+	}
+	return record
+}
+
+func TestLogToolResult(t *testing.T) {
+	body := json.RawMessage(`{"content":[{"type":"text","text":"hello"}],"isError":true}`)
+	rec := logResult(t, nil, ToolResultEvent{
+		Server:        "fs",
+		Tool:          "read_file",
+		RequestID:     3,
+		CorrelationID: "s-1",
+		IsError:       true,
+		Content:       []ContentSummary{{Type: "text", Bytes: 5}},
+		Bytes:         90,
+		Latency:       1500 * time.Microsecond,
+		Body:          body,
+	})
+	if rec["event"] != "tool_result" || rec["tool"] != "read_file" || rec["is_error"] != true {
+		t.Errorf("record = %v", rec)
+	}
+	if rec["latency_ms"] != 1.5 || rec["bytes"] != 90.0 || rec["correlation_id"] != "s-1" {
+		t.Errorf("record = %v", rec)
+	}
+	content, _ := rec["content"].([]any)
+	if len(content) != 1 || content[0].(map[string]any)["type"] != "text" {
+		t.Errorf("content = %v", rec["content"])
+	}
+	if _, ok := rec["body"]; ok {
+		t.Error("body recorded without result_body set")
+	}
+	if _, ok := rec["error_code"]; ok {
+		t.Error("error_code recorded for a successful response")
+	}
+
+	parsed, err := ParseRecord([]byte(mustMarshal(t, rec)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.IsError || parsed.LatencyMs != 1.5 || parsed.Tool != "read_file" {
+		t.Errorf("parsed = %+v", parsed)
+	}
+}
+
+func TestLogToolResultBody(t *testing.T) {
+	body := json.RawMessage(`{"content":[{"type":"text","text":"token hvs.abcdefghijklmnopqrstuvwx and more text"}]}`)
+
+	hashed := logResult(t, func(l *Logger) { l.SetResultBody(ResultBodyHash, 0) }, ToolResultEvent{Body: body})
+	sum := sha256.Sum256(body)
+	if hashed["body_sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("body_sha256 = %v", hashed["body_sha256"])
+	}
+
+	redactor, err := NewRedactor(RedactOptions{DetectSecrets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := logResult(t, func(l *Logger) {
+		l.SetRedactor(redactor)
+		l.SetResultBody(ResultBodyTruncate, 80)
+	}, ToolResultEvent{Body: body})
+	got, _ := truncated["body"].(string)
+	if strings.Contains(got, "hvs.") || !strings.Contains(got, "[REDACTED:vault_token]") {
+		t.Errorf("body not scrubbed: %q", got)
+	}
+	if len(got) > 80 || truncated["body_truncated"] != true {
+		t.Errorf("body not truncated: %q (%d bytes)", got, len(got))
+	}
+}
+
+func TestLogToolResultRPCError(t *testing.T) {
+	rec := logResult(t, nil, ToolResultEvent{Tool: "x", ErrorCode: -32602, ErrorMessage: "invalid params"})
+	if rec["error_code"] != -32602.0 || rec["error_message"] != "invalid params" || rec["is_error"] != false {
+		t.Errorf("record = %v", rec)
+	}
+}
@@ -0,0 +1,284 @@
+package audit
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOptions controls when a RotatingFile rotates and how long rotated
+// files are kept. Zero values disable the corresponding behaviour.
+type RotateOptions struct {
+	// MaxSize rotates the file before a write would take it past this many
+	// bytes.
+	MaxSize int64
+	// Interval rotates the file once it has been open this long.
+	Interval time.Duration
+	// Compress gzips rotated files in the background.
+	Compress bool
+	// MaxFiles is the number of rotated files to keep.
+	MaxFiles int
+	// MaxAge removes rotated files older than this.
+	MaxAge time.Duration
+}
+
+// rotatedTimeFormat is embedded in rotated file names. It sorts lexically
+// in time order.
+const rotatedTimeFormat = "20060102T150405.000"
+
+// RotatingFile is an append-only log file that rotates itself by size or
+// age. Rotated files are renamed to name-TIMESTAMP.ext, optionally gzipped,
+// and pruned according to the retention options.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	opts     RotateOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	bg       sync.WaitGroup
+	now      func() time.Time
+}
+
+// OpenRotatingFile opens path for appending, creating it if necessary.
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, opts: opts, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+// Write appends p, rotating first if the size or age limit is reached.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the current file rather than losing records.
+			log.Printf("WARNING: audit log rotation failed: %v", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) shouldRotate(incoming int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+incoming > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.Interval > 0 && f.now().Sub(f.openedAt) >= f.opts.Interval
+}
+
+// Rotate rotates the file now, regardless of the limits.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Reopen closes and reopens the file at its original path. It is meant to
+// be called on SIGHUP after an external tool such as logrotate has moved
+// the file away.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the file and waits for any background compression.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.bg.Wait()
+	return err
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	rotated := f.rotatedName(f.now())
+	renameErr := os.Rename(f.path, rotated)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	f.bg.Add(1)
+	go func() {
+		defer f.bg.Done()
+		if f.opts.Compress {
+			if err := compressFile(rotated); err != nil {
+				log.Printf("WARNING: compressing rotated audit log: %v", err)
+			}
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// rotatedName returns an unused name for a file rotated at t.
+func (f *RotatingFile) rotatedName(t time.Time) string {
+	base, ext := splitExt(f.path)
+	stamp := t.UTC().Format(rotatedTimeFormat)
+	name := fmt.Sprintf("%s-%s%s", base, stamp, ext)
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s-%s.%d%s", base, stamp, i, ext)
+	}
+	return name
+}
+
+// prune removes rotated files beyond the retention limits.
+func (f *RotatingFile) prune() {
+	if f.opts.MaxFiles <= 0 && f.opts.MaxAge <= 0 {
+		return
+	}
+	files, err := RotatedFiles(f.path)
+	if err != nil {
+		log.Printf("WARNING: listing rotated audit logs: %v", err)
+		return
+	}
+	// Newest first.
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	cutoff := f.now().Add(-f.opts.MaxAge)
+	for i, name := range files {
+		expired := false
+		if f.opts.MaxFiles > 0 && i >= f.opts.MaxFiles {
+			expired = true
+		} else if f.opts.MaxAge > 0 {
+			if info, err := os.Stat(name); err == nil && info.ModTime().Before(cutoff) {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(name); err != nil {
+				log.Printf("WARNING: removing old audit log: %v", err)
+			}
+		}
+	}
+}
+
+// RotatedFiles returns the rotated siblings of an audit log path, oldest
+// first. Compressed and uncompressed files are both included.
+func RotatedFiles(path string) ([]string, error) {
+	base, ext := splitExt(path)
+	matches, err := filepath.Glob(globEscape(base) + "-*" + globEscape(ext) + "*")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, m := range matches {
+		rest := strings.TrimPrefix(m, base+"-")
+		rest = strings.TrimSuffix(rest, ".gz")
+		if !strings.HasSuffix(rest, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(rest, ext)
+		if _, err := time.Parse(rotatedTimeFormat, stamp[:min(len(stamp), len(rotatedTimeFormat))]); err != nil {
+			continue
+		}
+		files = append(files, m)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := name + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Keep the original's mtime so age-based retention still works.
+	if info, err := in.Stat(); err == nil {
+		os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err := os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// splitExt splits "dir/audit.jsonl" into "dir/audit" and ".jsonl".
+func splitExt(path string) (base, ext string) {
+	ext = filepath.Ext(path)
+	return strings.TrimSuffix(path, ext), ext
+}
+
+func globEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+	return r.Replace(s)
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
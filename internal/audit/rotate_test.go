@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock returns a now function that advances only when told to.
+func fakeClock(start time.Time) (now func() time.Time, advance func(time.Duration)) {
+	t := start
+	return func() time.Time { return t }, func(d time.Duration) { t = t.Add(d) }
+}
+
+func openTestFile(t *testing.T, opts RotateOptions) (*RotatingFile, string, func(time.Duration)) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := OpenRotatingFile(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, advance := fakeClock(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	f.now = now
+	f.openedAt = now()
+	t.Cleanup(func() { f.Close() })
+	return f, path, advance
+}
+
+func TestRotateBySize(t *testing.T) {
+	f, path, advance := openTestFile(t, RotateOptions{MaxSize: 20})
+
+	f.Write([]byte("0123456789\n"))
+	f.Write([]byte("0123456789\n")) // would exceed 20 bytes: rotates first
+	advance(time.Millisecond)
+	f.Write([]byte("0123456789\n"))
+	f.Close()
+
+	rotated, err := RotatedFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("rotated files = %v, want 2", rotated)
+	}
+	for _, name := range append(rotated, path) {
+		data, _ := os.ReadFile(name)
+		if string(data) != "0123456789\n" {
+			t.Errorf("%s = %q, want one record", name, data)
+		}
+	}
+}
+
+func TestRotateByInterval(t *testing.T) {
+	f, path, advance := openTestFile(t, RotateOptions{Interval: time.Hour})
+
+	f.Write([]byte("a\n"))
+	advance(30 * time.Minute)
+	f.Write([]byte("b\n"))
+	advance(31 * time.Minute)
+	f.Write([]byte("c\n"))
+	f.Close()
+
+	rotated, _ := RotatedFiles(path)
+	if len(rotated) != 1 {
+		t.Fatalf("rotated files = %v, want 1", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[0]); string(data) != "a\nb\n" {
+		t.Errorf("rotated = %q, want a and b", data)
+	}
+	if !strings.Contains(rotated[0], "audit-20260102T") {
+		t.Errorf("rotated name = %s, want timestamped name", rotated[0])
+	}
+}
+
+func TestRotateCompressAndRetain(t *testing.T) {
+	f, path, advance := openTestFile(t, RotateOptions{Compress: true, MaxFiles: 2})
+
+	for _, rec := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		f.Write([]byte(rec))
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		f.bg.Wait()
+		advance(time.Second)
+	}
+	f.Close()
+
+	rotated, _ := RotatedFiles(path)
+	if len(rotated) != 2 {
+		t.Fatalf("rotated files = %v, want the 2 newest", rotated)
+	}
+	for i, want := range []string{"three\n", "four\n"} {
+		if !strings.HasSuffix(rotated[i], ".jsonl.gz") {
+			t.Fatalf("rotated file %s was not compressed", rotated[i])
+		}
+		if got := readGzip(t, rotated[i]); got != want {
+			t.Errorf("%s = %q, want %q", rotated[i], got, want)
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	f, path, _ := openTestFile(t, RotateOptions{})
+
+	f.Write([]byte("before\n"))
+	moved := path + ".1"
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+	f.Close()
+
+	if data, _ := os.ReadFile(moved); string(data) != "before\n" {
+		t.Errorf("moved file = %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "after\n" {
+		t.Errorf("reopened file = %q", data)
+	}
+}
+
+func readGzip(t *testing.T, name string) string {
+	t.Helper()
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
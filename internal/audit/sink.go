@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink is a destination for audit records. Write receives one encoded
+// record, including its trailing newline, and must not block on slow I/O:
+// sinks that talk to the network queue records and deliver them in the
+// background. Close flushes anything still queued.
+type Sink interface {
+	Write(record []byte) error
+	Close() error
+	Health() SinkHealth
+}
+
+// SinkHealth describes how a sink's deliveries are going.
+type SinkHealth struct {
+	Name string `json:"name"`
+	// Healthy is false while the most recent delivery attempt failed.
+	Healthy     bool      `json:"healthy"`
+	Written     uint64    `json:"written"`
+	Failed      uint64    `json:"failed"`
+	Dropped     uint64    `json:"dropped"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+}
+
+// ErrSinkFull is returned by Write when a sink's queue is full and the
+// record was dropped.
+var ErrSinkFull = errors.New("audit sink queue full")
+
+// sinkStats tracks delivery counts for a sink and logs when it starts
+// failing or recovers.
+type sinkStats struct {
+	mu sync.Mutex
+	h  SinkHealth
+}
+
+func newSinkStats(name string) *sinkStats {
+	return &sinkStats{h: SinkHealth{Name: name, Healthy: true}}
+}
+
+// delivered records the final outcome of delivering n records.
+func (s *sinkStats) delivered(n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.h.Written += uint64(n)
+		if !s.h.Healthy {
+			log.Printf("audit sink %s recovered", s.h.Name)
+		}
+		s.h.Healthy = true
+		return
+	}
+	s.h.Failed += uint64(n)
+	s.failing(err)
+}
+
+// attemptFailed records a failed attempt that will be retried.
+func (s *sinkStats) attemptFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing(err)
+}
+
+// failing marks the sink unhealthy. s.mu must be held.
+func (s *sinkStats) failing(err error) {
+	if s.h.Healthy {
+		log.Printf("WARNING: audit sink %s failing: %v", s.h.Name, err)
+	}
+	s.h.Healthy = false
+	s.h.LastError = err.Error()
+	s.h.LastErrorAt = time.Now()
+}
+
+func (s *sinkStats) dropped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.h.Dropped++
+}
+
+func (s *sinkStats) Health() SinkHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h
+}
+
+// WriterSink writes records synchronously to an io.Writer such as a file
+// or stderr.
+type WriterSink struct {
+	*sinkStats
+	w io.Writer
+}
+
+// NewWriterSink returns a sink that writes to w. Close closes w if it is an
+// io.Closer other than a standard stream.
+func NewWriterSink(name string, w io.Writer) *WriterSink {
+	return &WriterSink{sinkStats: newSinkStats(name), w: w}
+}
+
+func (s *WriterSink) Write(record []byte) error {
+	_, err := s.w.Write(record)
+	s.delivered(1, err)
+	return err
+}
+
+func (s *WriterSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok && !isStdStream(s.w) {
+		return c.Close()
+	}
+	return nil
+}
+
+func isStdStream(w io.Writer) bool {
+	return w == os.Stdout || w == os.Stderr
+}
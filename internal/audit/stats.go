@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"math"
+	"sort"
+)
+
+// Stats summarises tool call records.
+type Stats struct {
+	Calls    int         `json:"calls"`
+	Denied   int         `json:"denied"`
+	DenyRate float64     `json:"deny_rate"`
+	Latency  Percentiles `json:"latency_ms"`
+	// Tools is ordered by number of calls, most called first.
+	Tools []ToolStats `json:"tools"`
+}
+
+// ToolStats summarises the calls to one tool on one server.
+type ToolStats struct {
+	Server   string      `json:"server"`
+	Tool     string      `json:"tool"`
+	Calls    int         `json:"calls"`
+	Denied   int         `json:"denied"`
+	DenyRate float64     `json:"deny_rate"`
+	Latency  Percentiles `json:"latency_ms"`
+}
+
+// Percentiles of a latency distribution in milliseconds.
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// StatsCollector accumulates tool call records into Stats. Latency comes
+// from the tool_result records, joined to their call by correlation ID.
+type StatsCollector struct {
+	tools map[[2]string]*toolSamples
+	// pending maps the correlation ID of a collected call to its tool
+	// until the call's result arrives.
+	pending map[string]*toolSamples
+}
+
+type toolSamples struct {
+	calls, denied int
+	latencies     []float64
+}
+
+// NewStatsCollector returns an empty collector.
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{tools: map[[2]string]*toolSamples{}, pending: map[string]*toolSamples{}}
+}
+
+// Add records one tool_call record, or the latency of a tool_result
+// record for a call already added; other records are ignored.
+func (c *StatsCollector) Add(rec Record) {
+	switch rec.Event {
+	case "tool_call":
+	case "tool_result":
+		if t, ok := c.pending[rec.CorrelationID]; ok {
+			t.latencies = append(t.latencies, rec.LatencyMs)
+			delete(c.pending, rec.CorrelationID)
+		}
+		return
+	default:
+		return
+	}
+	key := [2]string{rec.Server, rec.Tool}
+	t := c.tools[key]
+	if t == nil {
+		t = &toolSamples{}
+		c.tools[key] = t
+	}
+	t.calls++
+	if rec.Decision == "deny" {
+		t.denied++
+	} else if rec.CorrelationID != "" {
+		c.pending[rec.CorrelationID] = t
+	}
+}
+
+// Stats returns the summary, keeping the top most-called tools; top <= 0
+// keeps them all.
+func (c *StatsCollector) Stats(top int) Stats {
+	var s Stats
+	var all []float64
+	for key, t := range c.tools {
+		s.Calls += t.calls
+		s.Denied += t.denied
+		all = append(all, t.latencies...)
+		s.Tools = append(s.Tools, ToolStats{
+			Server:   key[0],
+			Tool:     key[1],
+			Calls:    t.calls,
+			Denied:   t.denied,
+			DenyRate: rate(t.denied, t.calls),
+			Latency:  percentiles(t.latencies),
+		})
+	}
+	s.DenyRate = rate(s.Denied, s.Calls)
+	s.Latency = percentiles(all)
+	sort.Slice(s.Tools, func(i, j int) bool {
+		a, b := s.Tools[i], s.Tools[j]
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		if a.Server != b.Server {
+			return a.Server < b.Server
+		}
+		return a.Tool < b.Tool
+	})
+	if top > 0 && len(s.Tools) > top {
+		s.Tools = s.Tools[:top]
+	}
+	return s
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// percentiles uses the nearest-rank method.
+func percentiles(samples []float64) Percentiles {
+	if len(samples) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		return sorted[max(i, 0)]
+	}
+	return Percentiles{P50: rank(50), P90: rank(90), P99: rank(99), Max: sorted[len(sorted)-1]}
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SyslogOptions configures a syslog sink.
+type SyslogOptions struct {
+	// Network is "unix", "udp" or "tcp". For "unix", Address is a socket
+	// path such as /dev/log.
+	Network string
+	Address string
+	// Facility is a name such as "local0" or "auth"; the default is local0.
+	Facility string
+	// AppName defaults to "constellation".
+	AppName string
+}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// syslogSink sends each record as an RFC 5424 message. Stream transports
+// use octet-counting framing (RFC 6587).
+type syslogSink struct {
+	*batchSink
+	opts     SyslogOptions
+	facility int
+	hostname string
+	conn     net.Conn
+	stream   bool
+}
+
+// NewSyslogSink returns a sink that forwards records to a syslog daemon or
+// collector. The connection is made lazily and re-established after errors.
+func NewSyslogSink(opts SyslogOptions, batch BatchOptions) (Sink, error) {
+	if opts.Facility == "" {
+		opts.Facility = "local0"
+	}
+	facility, ok := syslogFacilities[opts.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", opts.Facility)
+	}
+	switch opts.Network {
+	case "unix", "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("syslog network must be unix, udp or tcp, got %q", opts.Network)
+	}
+	if opts.AppName == "" {
+		opts.AppName = "constellation"
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogSink{opts: opts, facility: facility, hostname: hostname}
+	s.batchSink = newBatchSink("syslog "+opts.Address, batch, s.send)
+	return s, nil
+}
+
+func (s *syslogSink) Close() error {
+	err := s.batchSink.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
+
+// send is only called from the batch goroutine, so it owns s.conn.
+func (s *syslogSink) send(ctx context.Context, batch [][]byte) error {
+	if s.conn == nil {
+		if err := s.dial(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+	for _, rec := range batch {
+		msg := s.format(rec, time.Now())
+		if s.stream {
+			msg = append(strconv.AppendInt(nil, int64(len(msg)), 10), append([]byte{' '}, msg...)...)
+		}
+		if _, err := s.conn.Write(msg); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) dial(ctx context.Context) error {
+	var d net.Dialer
+	network := s.opts.Network
+	if network == "unix" {
+		// Local daemons usually listen on a datagram socket; fall back to
+		// a stream socket for those that do not.
+		if conn, err := d.DialContext(ctx, "unixgram", s.opts.Address); err == nil {
+			s.conn, s.stream = conn, false
+			return nil
+		}
+	}
+	conn, err := d.DialContext(ctx, network, s.opts.Address)
+	if err != nil {
+		return err
+	}
+	s.conn, s.stream = conn, network != "udp"
+	return nil
+}
+
+// format renders an RFC 5424 message with the record's event as MSGID and
+// the JSON record as MSG.
+func (s *syslogSink) format(rec []byte, now time.Time) []byte {
+	rec = bytes.TrimRight(rec, "\n")
+	var fields struct {
+		Event    string `json:"event"`
+		Decision string `json:"decision"`
+	}
+	json.Unmarshal(rec, &fields)
+
+	severity := severityInfo
+	switch {
+	case fields.Event == "error":
+		severity = severityError
+	case fields.Decision == "deny":
+		severity = severityWarning
+	}
+	msgID := fields.Event
+	if msgID == "" {
+		msgID = "-"
+	}
+	return fmt.Appendf(nil, "<%d>1 %s %s %s %d %s - %s",
+		s.facility*8+severity, now.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, s.opts.AppName, os.Getpid(), msgID, rec)
+}
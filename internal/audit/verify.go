@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Problem is a point where the hash chain does not hold.
+type Problem struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Msg)
+}
+
+// VerifyResult summarises a chain verification.
+type VerifyResult struct {
+	Records     int
+	Checkpoints int
+	// FirstSeq and LastSeq are the sequence numbers at either end of the
+	// verified records. FirstSeq above 1 means earlier files were not given.
+	FirstSeq, LastSeq uint64
+	// SignedThrough is the sequence number of the last checkpoint whose
+	// signature verified; records after it are only protected by the
+	// unsigned hash chain.
+	SignedThrough uint64
+	Problems      []Problem
+}
+
+// OK reports whether the chain is intact.
+func (r *VerifyResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify checks the hash chain across files, which must be given oldest
+// first. It reports gaps and reordering in the sequence numbers, records
+// whose predecessor was modified, and, when key is non-nil, checkpoints
+// whose signature does not verify. The log is assumed to have a single
+// writer; proxies sharing one audit file interleave their chains.
+func Verify(key ed25519.PublicKey, files ...string) (*VerifyResult, error) {
+	v := &verifier{key: key, res: &VerifyResult{}}
+	for _, name := range files {
+		if err := v.file(name); err != nil {
+			return nil, err
+		}
+	}
+	return v.res, nil
+}
+
+type verifier struct {
+	key      ed25519.PublicKey
+	res      *VerifyResult
+	seq      uint64
+	prevHash string
+	started  bool
+	// resync skips the continuity checks for the next record, after a
+	// problem has already been reported for the one before it.
+	resync bool
+}
+
+func (v *verifier) file(name string) error {
+	r, err := OpenLog(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		v.record(name, line, scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	return nil
+}
+
+func (v *verifier) record(file string, line int, data []byte) {
+	problem := func(format string, args ...any) {
+		v.res.Problems = append(v.res.Problems, Problem{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	var rec struct {
+		Seq       *uint64 `json:"seq"`
+		PrevHash  string  `json:"prev_hash"`
+		Event     string  `json:"event"`
+		KeyID     string  `json:"key_id"`
+		Signature string  `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		problem("malformed record: %v", err)
+		v.resync = true
+		return
+	}
+	if rec.Seq == nil {
+		problem("record has no sequence number")
+		v.resync = true
+		return
+	}
+	seq := *rec.Seq
+	v.res.Records++
+
+	switch {
+	case !v.started:
+		v.res.FirstSeq = seq
+	case v.resync:
+	case seq == 1 && rec.PrevHash == "":
+		problem("chain restarts at seq 1 after seq %d", v.seq)
+	case seq <= v.seq:
+		problem("out of order: seq %d after seq %d", seq, v.seq)
+	case seq > v.seq+1:
+		problem("gap: records %s missing", seqRange(v.seq+1, seq-1))
+	case rec.PrevHash != v.prevHash:
+		problem("hash chain broken: record %d was modified or replaced", v.seq)
+	}
+
+	if rec.Event == "checkpoint" {
+		v.res.Checkpoints++
+		if v.key != nil {
+			v.checkpoint(seq, rec.PrevHash, rec.KeyID, rec.Signature, problem)
+		}
+	}
+
+	v.started = true
+	v.resync = false
+	v.seq = seq
+	v.prevHash = hashLine(data)
+	v.res.LastSeq = seq
+}
+
+func (v *verifier) checkpoint(seq uint64, prevHash, keyID, signature string, problem func(string, ...any)) {
+	if want := KeyID(v.key); keyID != want {
+		problem("checkpoint %d signed with key %s, not %s", seq, keyID, want)
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(v.key, checkpointMessage(seq, prevHash), sig) {
+		problem("checkpoint %d has an invalid signature", seq)
+		return
+	}
+	v.res.SignedThrough = seq
+}
+
+func seqRange(from, to uint64) string {
+	if from == to {
+		return fmt.Sprint(from)
+	}
+	return fmt.Sprintf("%d-%d", from, to)
+}
@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signedLog writes n tool calls and a shutdown with checkpoints every 3
+// records, returning the log lines.
+func signedLog(t *testing.T, key ed25519.PrivateKey, n int) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := New(&buf)
+	logger.SetSigner(key, 3)
+	logger.LogStartup("fs", "constellation.yaml")
+	for i := 0; i < n; i++ {
+		logger.LogToolCall(ToolCallEvent{Server: "fs", Tool: "read_file", Decision: "allow", Arguments: map[string]any{"i": i}})
+	}
+	logger.LogShutdown("fs")
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, lines []string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestChainLinksRecords(t *testing.T) {
+	lines := signedLog(t, newKey(t), 2)
+	prev := ""
+	for i, line := range lines {
+		var rec struct {
+			Seq      uint64 `json:"seq"`
+			PrevHash string `json:"prev_hash"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Seq != uint64(i+1) {
+			t.Errorf("line %d: seq = %d, want %d", i, rec.Seq, i+1)
+		}
+		if rec.PrevHash != prev {
+			t.Errorf("line %d: prev_hash = %q, want %q", i, rec.PrevHash, prev)
+		}
+		prev = hashLine([]byte(line))
+	}
+	if !strings.Contains(lines[len(lines)-1], `"event":"checkpoint"`) {
+		t.Error("log does not end with a checkpoint after shutdown")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := newKey(t)
+	pub := key.Public().(ed25519.PublicKey)
+	lines := signedLog(t, key, 6)
+
+	tests := []struct {
+		name   string
+		edit   func([]string) []string
+		key    ed25519.PublicKey
+		errMsg string
+	}{
+		{name: "intact", edit: func(l []string) []string { return l }, key: pub},
+		{name: "intact without key", edit: func(l []string) []string { return l }},
+		{
+			name:   "removed record",
+			edit:   func(l []string) []string { return append(l[:2:2], l[3:]...) },
+			key:    pub,
+			errMsg: "gap: records 3 missing",
+		},
+		{
+			name: "reordered records",
+			edit: func(l []string) []string {
+				l = append([]string(nil), l...)
+				l[1], l[2] = l[2], l[1]
+				return l
+			},
+			key:    pub,
+			errMsg: "out of order: seq 2 after seq 3",
+		},
+		{
+			name: "modified record",
+			edit: func(l []string) []string {
+				l = append([]string(nil), l...)
+				l[1] = strings.Replace(l[1], `"allow"`, `"deny"`, 1)
+				return l
+			},
+			key:    pub,
+			errMsg: "hash chain broken: record 2 was modified",
+		},
+		{
+			name:   "wrong key",
+			edit:   func(l []string) []string { return l },
+			key:    newKey(t).Public().(ed25519.PublicKey),
+			errMsg: "signed with key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Verify(tt.key, writeLines(t, tt.edit(lines)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg == "" {
+				if !res.OK() {
+					t.Fatalf("problems = %v, want none", res.Problems)
+				}
+				return
+			}
+			if res.OK() {
+				t.Fatalf("no problems reported, want %q", tt.errMsg)
+			}
+			for _, p := range res.Problems {
+				if strings.Contains(p.Msg, tt.errMsg) {
+					return
+				}
+			}
+			t.Errorf("problems = %v, want one containing %q", res.Problems, tt.errMsg)
+		})
+	}
+}
+
+func TestVerifyRewrittenChainFailsSignature(t *testing.T) {
+	key := newKey(t)
+	lines := signedLog(t, key, 6)
+
+	// Rewrite record 2 and recompute every later hash, as someone without
+	// the signing key would have to.
+	var buf bytes.Buffer
+	forger := New(&buf)
+	for i, line := range lines {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			rec["decision"] = "deny"
+		}
+		forger.write(rec)
+	}
+	forged := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	res, err := Verify(key.Public().(ed25519.PublicKey), writeLines(t, forged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OK() || !strings.Contains(res.Problems[0].Msg, "invalid signature") {
+		t.Fatalf("problems = %v, want an invalid checkpoint signature", res.Problems)
+	}
+}
+
+func TestResumeAcrossRotation(t *testing.T) {
+	key := newKey(t)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := OpenRotatingFile(path, RotateOptions{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := New(f)
+	logger.SetSigner(key, 0)
+	logger.LogStartup("fs", "p.yaml")
+	logger.LogShutdown("fs")
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted proxy picks the chain up from the rotated file.
+	last, err := LastRecord(path)
+	if err != nil || last == nil {
+		t.Fatalf("LastRecord() = %q, %v", last, err)
+	}
+	f, err = OpenRotatingFile(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger = New(f)
+	logger.SetSigner(key, 0)
+	if err := logger.Resume(last); err != nil {
+		t.Fatal(err)
+	}
+	logger.LogStartup("fs", "p.yaml")
+	logger.LogShutdown("fs")
+	f.Close()
+
+	rotated, err := RotatedFiles(path)
+	if err != nil || len(rotated) != 1 || !strings.HasSuffix(rotated[0], ".gz") {
+		t.Fatalf("RotatedFiles() = %v, %v, want one gzipped file", rotated, err)
+	}
+	res, err := Verify(key.Public().(ed25519.PublicKey), append(rotated, path)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.OK() {
+		t.Fatalf("problems = %v", res.Problems)
+	}
+	if res.Records != 6 || res.SignedThrough != 6 {
+		t.Errorf("Records = %d, SignedThrough = %d, want 6 and 6", res.Records, res.SignedThrough)
+	}
+}
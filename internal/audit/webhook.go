@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// HTTPOptions configures a sink that POSTs records over HTTP.
+type HTTPOptions struct {
+	URL     string
+	Headers map[string]string
+}
+
+// NewWebhookSink returns a sink that POSTs batches of records to a URL as a
+// JSON array. Failed batches are retried with backoff.
+func NewWebhookSink(opts HTTPOptions, batch BatchOptions) Sink {
+	return newBatchSink("webhook "+safeURL(opts.URL), batch, func(ctx context.Context, records [][]byte) error {
+		var body bytes.Buffer
+		body.WriteByte('[')
+		for i, rec := range records {
+			if i > 0 {
+				body.WriteByte(',')
+			}
+			body.Write(bytes.TrimRight(rec, "\n"))
+		}
+		body.WriteByte(']')
+		return post(ctx, opts, body.Bytes())
+	})
+}
+
+// post sends a JSON body and treats any non-2xx response as a failure.
+func post(ctx context.Context, opts HTTPOptions, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("POST %s: invalid URL", safeURL(opts.URL))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = safeURL(opts.URL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", safeURL(opts.URL), resp.Status)
+	}
+	return nil
+}
+
+// safeURL returns raw without its userinfo, query and fragment, which may
+// carry credentials, for use in sink names and errors.
+func safeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	u.User, u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = nil, "", false, "", ""
+	return u.String()
+}
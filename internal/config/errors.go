@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Pos identifies a location in a policy file.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position refers to a file.
+func (p Pos) IsValid() bool {
+	return p.File != ""
+}
+
+func (p Pos) String() string {
+	switch {
+	case p.File == "":
+		return ""
+	case p.Line == 0:
+		return p.File
+	case p.Column == 0:
+		return fmt.Sprintf("%s:%d", p.File, p.Line)
+	default:
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+}
+
+// fieldPositions maps the dotted path of each field written in a block,
+// such as "default" or "initialize.strip_capabilities[1]", to its position.
+type fieldPositions map[string]Pos
+
+// at returns the position of path, or of its nearest recorded parent when
+// the field itself was not written, falling back to pos.
+func (f fieldPositions) at(path string, pos Pos) Pos {
+	for {
+		if p, ok := f[path]; ok {
+			return p
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			return pos
+		}
+		path = path[:i]
+	}
+}
+
+// Error is a configuration error tied to a location in a policy file.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// errorf creates an Error at the given position.
+func errorf(pos Pos, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// ErrorList collects every error found while loading or validating a
+// policy so they can be reported together.
+type ErrorList []*Error
+
+// Add appends an error at the given position.
+func (l *ErrorList) Add(pos Pos, format string, args ...any) {
+	*l = append(*l, errorf(pos, format, args...))
+}
+
+// append adds err to the list, flattening ErrorLists and wrapping errors
+// that carry no position.
+func (l *ErrorList) append(err error) {
+	var list ErrorList
+	var e *Error
+	switch {
+	case err == nil:
+	case errors.As(err, &list):
+		*l = append(*l, list...)
+	case errors.As(err, &e):
+		*l = append(*l, e)
+	default:
+		*l = append(*l, &Error{Msg: err.Error()})
+	}
+}
+
+// Sort orders the list by file, line and column. Errors without a position
+// sort first.
+func (l ErrorList) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].Pos, l[j].Pos
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// Err returns the list as an error, or nil if it is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Warning describes a policy construct that is valid but probably not what
+// the author intended.
+type Warning struct {
+	Pos Pos
+	Msg string
+}
+
+func (w Warning) String() string {
+	if !w.Pos.IsValid() {
+		return w.Msg
+	}
+	return w.Pos.String() + ": " + w.Msg
+}
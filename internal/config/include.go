@@ -0,0 +1,346 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loader reads a root policy file and everything it includes, merging the
+// definitions into a single Config.
+type loader struct {
+	cfg *Config
+
+	// stack holds the absolute paths of the files currently being loaded,
+	// outermost first, so that include cycles can be reported in full.
+	stack []string
+	// loaded records every file already merged; including a file twice
+	// through different paths is not an error, it is just read once.
+	loaded map[string]bool
+	// defined records where each named server, template and rule set was
+	// first declared so duplicates can point at both definitions.
+	defined map[string]Pos
+	// errs collects problems that do not stop loading, such as unknown
+	// fields, so they can be reported together with validation errors.
+	errs ErrorList
+}
+
+func newLoader() *loader {
+	return &loader{
+		cfg:     &Config{},
+		loaded:  map[string]bool{},
+		defined: map[string]Pos{},
+	}
+}
+
+// loadFile parses path and merges it into the loader's config. from is the
+// position of the include entry that referenced the file, or the zero Pos
+// for the root file.
+func (l *loader) loadFile(path string, from Pos) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errorf(from, "resolving include %q: %v", path, err)
+	}
+	for i, p := range l.stack {
+		if p == abs {
+			cycle := append(append([]string{}, l.stack[i:]...), abs)
+			return errorf(from, "include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if l.loaded[abs] {
+		return nil
+	}
+	l.loaded[abs] = true
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !from.IsValid() {
+			return fmt.Errorf("reading config: %w", err)
+		}
+		return errorf(from, "reading include: %v", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	root := documentRoot(&doc)
+	var fc Config
+	if doc.Kind != 0 {
+		if err := doc.Decode(&fc); err != nil {
+			var typeErr *yaml.TypeError
+			if !errors.As(err, &typeErr) {
+				return fmt.Errorf("parsing config %s: %w", path, err)
+			}
+			// Type errors are not fatal: yaml.v3 decodes everything else.
+			for _, msg := range typeErr.Errors {
+				l.errs = append(l.errs, typeError(path, msg))
+			}
+		}
+		checkFields(path, root, reflect.TypeOf(Config{}), &l.errs)
+	}
+	annotate(path, root, &fc)
+
+	l.stack = append(l.stack, abs)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	if err := l.merge(path, root, &fc, !from.IsValid()); err != nil {
+		return err
+	}
+
+	includes := mappingValue(root, "include")
+	for i, inc := range fc.Include {
+		pos := nodePos(path, includes)
+		if includes != nil && i < len(includes.Content) {
+			pos = nodePos(path, includes.Content[i])
+		}
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		if err := l.include(inc, pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// include loads a single include entry, which may name a file or a
+// directory. Directories contribute every *.yaml and *.yml file they
+// contain, in lexical order; subdirectories are not descended into.
+func (l *loader) include(path string, from Pos) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errorf(from, "reading include: %v", err)
+	}
+	if !info.IsDir() {
+		return l.loadFile(path, from)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return errorf(from, "reading include: %v", err)
+	}
+	var files []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if err := l.loadFile(f, from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge folds the definitions from one file into the loader's config.
+// Servers, templates and rule sets must be uniquely named across all files.
+// Included files may repeat the root version but not change it, and vault
+// and audit may only be configured once.
+func (l *loader) merge(path string, root *yaml.Node, fc *Config, isRoot bool) error {
+	if isRoot {
+		l.cfg.Version = fc.Version
+		l.cfg.Include = fc.Include
+		l.cfg.pos = fc.pos
+	} else if fc.Version != "" && fc.Version != l.cfg.Version {
+		return errorf(nodePos(path, mappingValue(root, "version")),
+			"version %q does not match root policy version %q", fc.Version, l.cfg.Version)
+	}
+
+	if fc.Vault != nil {
+		if l.cfg.Vault != nil {
+			return errorf(nodePos(path, mappingValue(root, "vault")),
+				"vault already configured at %s", l.defined["vault"])
+		}
+		l.cfg.Vault = fc.Vault
+		l.defined["vault"] = nodePos(path, mappingValue(root, "vault"))
+	}
+
+	if fc.Audit != nil {
+		if l.cfg.Audit != nil {
+			return errorf(fc.Audit.pos, "audit already configured at %s", l.cfg.Audit.pos)
+		}
+		l.cfg.Audit = fc.Audit
+	}
+
+	for name, rules := range fc.RuleSets {
+		pos := keyPos(path, mappingValue(root, "rule_sets"), name)
+		if err := l.define("rule set", name, pos); err != nil {
+			return err
+		}
+		if l.cfg.RuleSets == nil {
+			l.cfg.RuleSets = map[string][]Rule{}
+		}
+		l.cfg.RuleSets[name] = rules
+	}
+	for name, tmpl := range fc.Templates {
+		if err := l.define("template", name, tmpl.pos); err != nil {
+			return err
+		}
+		if l.cfg.Templates == nil {
+			l.cfg.Templates = map[string]Server{}
+		}
+		l.cfg.Templates[name] = tmpl
+	}
+	for name, srv := range fc.Servers {
+		if err := l.define("server", name, srv.pos); err != nil {
+			return err
+		}
+		if l.cfg.Servers == nil {
+			l.cfg.Servers = map[string]Server{}
+		}
+		l.cfg.Servers[name] = srv
+	}
+	return nil
+}
+
+// define records that a named object of the given kind was declared at pos.
+func (l *loader) define(kind, name string, pos Pos) error {
+	key := kind + " " + name
+	if prev, ok := l.defined[key]; ok {
+		return errorf(pos, "%s %q already defined at %s", kind, name, prev)
+	}
+	l.defined[key] = pos
+	return nil
+}
+
+// annotate fills in source positions for the servers, templates and rules
+// decoded from root.
+func annotate(file string, root *yaml.Node, fc *Config) {
+	fc.pos = nodePos(file, root)
+	if fc.Vault != nil {
+		fc.Vault.pos = keyPos(file, root, "vault")
+		fc.Vault.fields = fields(file, mappingValue(root, "vault"))
+	}
+	if fc.Audit != nil {
+		audit := mappingValue(root, "audit")
+		fc.Audit.pos = keyPos(file, root, "audit")
+		fc.Audit.fields = fields(file, audit)
+		if sinks := mappingValue(audit, "sinks"); sinks != nil && sinks.Kind == yaml.SequenceNode {
+			for i := range fc.Audit.Sinks {
+				if i < len(sinks.Content) {
+					fc.Audit.Sinks[i].pos = nodePos(file, sinks.Content[i])
+					fc.Audit.Sinks[i].fields = fields(file, sinks.Content[i])
+				}
+			}
+		}
+	}
+	annotateServers(file, mappingValue(root, "servers"), fc.Servers)
+	annotateServers(file, mappingValue(root, "templates"), fc.Templates)
+
+	sets := mappingValue(root, "rule_sets")
+	for name, rules := range fc.RuleSets {
+		annotateRules(file, mappingValue(sets, name), rules)
+	}
+}
+
+func annotateServers(file string, node *yaml.Node, servers map[string]Server) {
+	for name, srv := range servers {
+		srv.pos = keyPos(file, node, name)
+		srv.fields = fields(file, mappingValue(node, name))
+		annotateRules(file, mappingValue(mappingValue(node, name), "rules"), srv.Rules)
+		servers[name] = srv
+	}
+}
+
+func annotateRules(file string, node *yaml.Node, rules []Rule) {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return
+	}
+	for i := range rules {
+		if i < len(node.Content) {
+			rules[i].pos = nodePos(file, node.Content[i])
+			rules[i].fields = fields(file, node.Content[i])
+		}
+	}
+}
+
+// fields records the position of every mapping key and sequence element
+// below n, keyed by its dotted path from n.
+func fields(file string, n *yaml.Node) fieldPositions {
+	f := fieldPositions{}
+	var walk func(prefix string, n *yaml.Node)
+	walk = func(prefix string, n *yaml.Node) {
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				path := n.Content[i].Value
+				if prefix != "" {
+					path = prefix + "." + path
+				}
+				f[path] = nodePos(file, n.Content[i])
+				walk(path, n.Content[i+1])
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				path := fmt.Sprintf("%s[%d]", prefix, i)
+				f[path] = nodePos(file, c)
+				walk(path, c)
+			}
+		}
+	}
+	if n != nil {
+		walk("", n)
+	}
+	return f
+}
+
+// typeError converts one message from a yaml.TypeError, which look like
+// "line 5: cannot unmarshal ...", into a positioned Error.
+func typeError(file, msg string) *Error {
+	var line int
+	if _, err := fmt.Sscanf(msg, "line %d:", &line); err == nil {
+		_, msg, _ = strings.Cut(msg, ": ")
+	}
+	return errorf(Pos{File: file, Line: line}, "%s", msg)
+}
+
+// documentRoot returns the top-level mapping of a parsed YAML document.
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
+
+// mappingValue returns the value node for key in a mapping node, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// keyPos returns the position of key within a mapping node, falling back
+// to the mapping itself if the key is absent.
+func keyPos(file string, n *yaml.Node, key string) Pos {
+	if n != nil && n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return nodePos(file, n.Content[i])
+			}
+		}
+	}
+	return nodePos(file, n)
+}
+
+func nodePos(file string, n *yaml.Node) Pos {
+	if n == nil {
+		return Pos{File: file}
+	}
+	return Pos{File: file, Line: n.Line, Column: n.Column}
+}
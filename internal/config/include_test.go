@@ -0,0 +1,194 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadIncludeFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "shared.yaml", `
+rule_sets:
+  read_only:
+    - tool: read_file
+      allow: true
+`)
+	root := writeFile(t, dir, "constellation.yaml", `
+version: "1"
+include: ["shared.yaml"]
+servers:
+  fs:
+    command: "fs-server"
+    default: deny
+    rule_sets: [read_only]
+`)
+	cfg, err := Load(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rules := cfg.Servers["fs"].Rules
+	if len(rules) != 1 || rules[0].Tool != "read_file" {
+		t.Fatalf("rules = %+v, want read_file from rule set", rules)
+	}
+	if got := rules[0].Source(); got.File != filepath.Join(dir, "shared.yaml") || got.Line != 4 {
+		t.Errorf("rule source = %v, want shared.yaml:4", got)
+	}
+}
+
+func TestLoadIncludeAbsolute(t *testing.T) {
+	shared := writeFile(t, t.TempDir(), "base.yaml", `
+rule_sets:
+  read_only:
+    - tool: read_file
+      allow: true
+`)
+	root := writeFile(t, t.TempDir(), "constellation.yaml", `
+version: "1"
+include: [`+shared+`]
+servers:
+  fs:
+    command: "fs-server"
+    default: deny
+    rule_sets: [read_only]
+`)
+	cfg, err := Load(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Servers["fs"].Rules[0].Source().File; got != shared {
+		t.Errorf("rule source = %s, want %s", got, shared)
+	}
+}
+
+func TestLoadIncludeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "servers.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "servers.d/a.yaml", `
+servers:
+  a:
+    command: "a"
+    default: deny
+`)
+	writeFile(t, dir, "servers.d/b.yml", `
+servers:
+  b:
+    command: "b"
+    default: allow
+`)
+	writeFile(t, dir, "servers.d/notes.txt", "not yaml")
+	root := writeFile(t, dir, "constellation.yaml", `
+version: "1"
+include: ["servers.d"]
+`)
+	cfg, err := Load(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Servers) != 2 {
+		t.Fatalf("servers = %d, want 2", len(cfg.Servers))
+	}
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.yaml", `include: ["b.yaml"]`)
+	writeFile(t, dir, "b.yaml", `include: ["a.yaml"]`)
+	root := writeFile(t, dir, "constellation.yaml", `
+version: "1"
+include: ["a.yaml"]
+`)
+	_, err := Load(root)
+	if err == nil {
+		t.Fatal("expected error for include cycle")
+	}
+	if !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("error = %v, want include cycle", err)
+	}
+	if !strings.Contains(err.Error(), "b.yaml:1:") {
+		t.Errorf("error = %v, want position in b.yaml", err)
+	}
+}
+
+func TestLoadIncludeDiamond(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "common.yaml", `
+rule_sets:
+  base:
+    - tool: ping
+      allow: true
+`)
+	writeFile(t, dir, "a.yaml", `include: ["common.yaml"]`)
+	writeFile(t, dir, "b.yaml", `include: ["common.yaml"]`)
+	root := writeFile(t, dir, "constellation.yaml", `
+version: "1"
+include: ["a.yaml", "b.yaml"]
+servers:
+  s:
+    command: "s"
+    default: deny
+    rule_sets: [base]
+`)
+	if _, err := Load(root); err != nil {
+		t.Fatalf("including the same file twice should not fail: %v", err)
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "missing include",
+			files: map[string]string{
+				"constellation.yaml": "version: \"1\"\ninclude: [\"nope.yaml\"]\n",
+			},
+			wantErr: "constellation.yaml:2:",
+		},
+		{
+			name: "duplicate server",
+			files: map[string]string{
+				"constellation.yaml": "version: \"1\"\ninclude: [\"other.yaml\"]\nservers:\n  fs:\n    command: x\n    default: deny\n",
+				"other.yaml":         "servers:\n  fs:\n    command: y\n    default: deny\n",
+			},
+			wantErr: `other.yaml:2:3: server "fs" already defined at`,
+		},
+		{
+			name: "version mismatch",
+			files: map[string]string{
+				"constellation.yaml": "version: \"1\"\ninclude: [\"other.yaml\"]\n",
+				"other.yaml":         "version: \"2\"\n",
+			},
+			wantErr: "does not match root policy version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, dir, name, content)
+			}
+			_, err := Load(filepath.Join(dir, "constellation.yaml"))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
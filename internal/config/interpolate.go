@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LookupFunc returns the value of an environment variable and whether it
+// is set. os.LookupEnv satisfies it.
+type LookupFunc func(name string) (string, bool)
+
+// Interpolate expands ${VAR} and ${VAR:-default} references in server
+// commands and args, rule when patterns, the vault address, audit sink
+// paths, addresses, URLs and headers, and the redaction hash salt. The default
+// is used when the variable is unset or empty; referencing an unset
+// variable without a default is an error. A literal "${" is written "$${".
+// Every failed reference is reported in the returned ErrorList.
+//
+// Interpolate should run after Resolve so that values inherited from
+// templates and rule sets are expanded for every server that uses them.
+func Interpolate(cfg *Config, lookup LookupFunc) error {
+	var errs ErrorList
+	if cfg.Vault != nil {
+		addr, err := expandVars(cfg.Vault.Address, lookup)
+		if err != nil {
+			errs.Add(cfg.Vault.fields.at("address", cfg.Vault.pos), "vault.address: %v", err)
+		}
+		cfg.Vault.Address = addr
+	}
+	if cfg.Audit != nil {
+		if r := cfg.Audit.Redact; r != nil {
+			salt, err := expandVars(r.HashSalt, lookup)
+			if err != nil {
+				errs.Add(cfg.Audit.fields.at("redact.hash_salt", cfg.Audit.pos), "audit: redact.hash_salt: %v", err)
+			}
+			redact := *r
+			redact.HashSalt = salt
+			cfg.Audit.Redact = &redact
+		}
+		for i := range cfg.Audit.Sinks {
+			interpolateSink(i, &cfg.Audit.Sinks[i], lookup, &errs)
+		}
+	}
+
+	for _, name := range sortedServerNames(cfg.Servers) {
+		srv := cfg.Servers[name]
+
+		cmd, err := expandVars(srv.Command, lookup)
+		if err != nil {
+			errs.Add(srv.fields.at("command", srv.pos), "server %q: command: %v", name, err)
+		}
+		srv.Command = cmd
+
+		if srv.Args != nil {
+			args := make([]string, len(srv.Args))
+			for i, arg := range srv.Args {
+				if args[i], err = expandVars(arg, lookup); err != nil {
+					errs.Add(srv.fields.at(fmt.Sprintf("args[%d]", i), srv.pos), "server %q: args[%d]: %v", name, i, err)
+				}
+			}
+			srv.Args = args
+		}
+
+		// Rules and their when maps may be shared with rule sets and
+		// templates, so expand into fresh copies.
+		rules := make([]Rule, len(srv.Rules))
+		for i, rule := range srv.Rules {
+			rules[i] = rule
+			if rule.When == nil {
+				continue
+			}
+			when := make(map[string]string, len(rule.When))
+			for key, pattern := range rule.When {
+				if when[key], err = expandVars(pattern, lookup); err != nil {
+					errs.Add(rule.fields.at("when."+key, rule.pos), "server %q: rule %d: when.%s: %v", name, i, key, err)
+				}
+			}
+			rules[i].When = when
+		}
+		if srv.Rules != nil {
+			srv.Rules = rules
+		}
+
+		cfg.Servers[name] = srv
+	}
+	return errs.Err()
+}
+
+func interpolateSink(i int, s *SinkConfig, lookup LookupFunc, errs *ErrorList) {
+	expand := func(field string, v *string) {
+		var err error
+		if *v, err = expandVars(*v, lookup); err != nil {
+			errs.Add(s.fields.at(field, s.pos), "audit: sinks[%d]: %s: %v", i, field, err)
+		}
+	}
+	expand("path", &s.Path)
+	expand("address", &s.Address)
+	expand("url", &s.URL)
+	if s.Headers != nil {
+		headers := make(map[string]string, len(s.Headers))
+		for _, k := range sortedKeys(s.Headers) {
+			v := s.Headers[k]
+			expand("headers."+k, &v)
+			headers[k] = v
+		}
+		s.Headers = headers
+	}
+}
+
+// expandVars performs variable substitution on a single string.
+func expandVars(s string, lookup LookupFunc) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// Escaped: "$${" produces a literal "${".
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s[i:])
+		}
+		expr := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		name, def, hasDefault := strings.Cut(expr, ":-")
+		if !isVarName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+		val, ok := lookup(name)
+		switch {
+		case ok && val != "":
+			b.WriteString(val)
+		case hasDefault:
+			b.WriteString(def)
+		case ok:
+			// Set but empty, no default: expand to the empty string.
+		default:
+			return "", fmt.Errorf("undefined variable %q (use ${%s:-default} to provide a fallback)", name, name)
+		}
+	}
+}
+
+func isVarName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	env := map[string]string{"HOME": "/home/alice", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "no vars", want: "no vars"},
+		{in: "${HOME}/projects/**", want: "/home/alice/projects/**"},
+		{in: "${UNSET:-/tmp}/**", want: "/tmp/**"},
+		{in: "${HOME:-/tmp}", want: "/home/alice"},
+		{in: "${EMPTY:-fallback}", want: "fallback"},
+		{in: "x${EMPTY}y", want: "xy"},
+		{in: "$${HOME}", want: "${HOME}"},
+		{in: "$HOME", want: "$HOME"},
+		{in: "${UNSET}", wantErr: true},
+		{in: "${HOME", wantErr: true},
+		{in: "${1BAD}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := expandVars(tt.in, lookup)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandVars(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expandVars(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadInterpolatesEnv(t *testing.T) {
+	t.Setenv("CONSTELLATION_TEST_ROOT", "/srv/data")
+	t.Setenv("CONSTELLATION_TEST_BIN", "fs-server")
+
+	path := writeTempFile(t, `
+version: "1"
+vault:
+  address: "${CONSTELLATION_TEST_VAULT:-http://127.0.0.1:8200}"
+  auth:
+    method: token
+rule_sets:
+  shared:
+    - tool: read_file
+      allow: true
+      when:
+        path: "${CONSTELLATION_TEST_ROOT}/**"
+servers:
+  fs:
+    command: "${CONSTELLATION_TEST_BIN}"
+    args: ["--root", "${CONSTELLATION_TEST_ROOT}"]
+    default: deny
+    rule_sets: [shared]
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Vault.Address != "http://127.0.0.1:8200" {
+		t.Errorf("vault.address = %q, want default", cfg.Vault.Address)
+	}
+	srv := cfg.Servers["fs"]
+	if srv.Command != "fs-server" {
+		t.Errorf("command = %q, want %q", srv.Command, "fs-server")
+	}
+	if srv.Args[1] != "/srv/data" {
+		t.Errorf("args[1] = %q, want %q", srv.Args[1], "/srv/data")
+	}
+	if srv.Rules[0].When["path"] != "/srv/data/**" {
+		t.Errorf("when.path = %q, want %q", srv.Rules[0].When["path"], "/srv/data/**")
+	}
+	if cfg.RuleSets["shared"][0].When["path"] != "${CONSTELLATION_TEST_ROOT}/**" {
+		t.Error("interpolation should not modify the shared rule set")
+	}
+}
+
+func TestLoadUndefinedVariable(t *testing.T) {
+	path := writeTempFile(t, `version: "1"
+servers:
+  fs:
+    command: "fs"
+    default: deny
+    rules:
+      - tool: read_file
+        allow: true
+        when:
+          path: "${CONSTELLATION_TEST_UNDEFINED}/**"
+`)
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for undefined variable")
+	}
+	if !strings.Contains(err.Error(), "test.yaml:10:11") || !strings.Contains(err.Error(), "CONSTELLATION_TEST_UNDEFINED") {
+		t.Errorf("error = %v, want position and variable name", err)
+	}
+}
@@ -3,49 +3,35 @@ package config
 import (
 	"fmt"
 	"os"
-
-	"gopkg.in/yaml.v3"
 )
 
-// Load reads and parses a constellation YAML policy file.
+// Load reads and parses a constellation YAML policy file, following its
+// include directives and resolving rule sets and server templates.
+// Relative include paths are interpreted relative to the including file.
+// Environment variable references are expanded after resolution; see
+// Interpolate. Unknown fields are rejected. All errors found are returned
+// together as an ErrorList, each tagged with its file, line and column.
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("reading config: %w", err)
-	}
-
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("parsing config: %w", err)
+	l := newLoader()
+	if err := l.loadFile(path, Pos{}); err != nil {
+		return nil, err
 	}
+	cfg := l.cfg
 
-	if err := Validate(&cfg); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+	// Unknown fields and type errors do not stop loading; they are
+	// reported along with everything Validate finds.
+	errs := l.errs
+	if err := Resolve(cfg); err != nil {
+		errs.append(err)
+		errs.Sort()
+		return nil, fmt.Errorf("invalid config: %w", errs)
 	}
+	errs.append(Interpolate(cfg, os.LookupEnv))
+	errs.append(Validate(cfg))
 
-	return &cfg, nil
-}
-
-// Validate checks that a Config has all required fields and valid values.
-func Validate(cfg *Config) error {
-	if cfg.Version == "" {
-		return fmt.Errorf("missing required field: version")
-	}
-	if len(cfg.Servers) == 0 {
-		return fmt.Errorf("at least one server must be defined")
-	}
-	for name, srv := range cfg.Servers {
-		if srv.Command == "" {
-			return fmt.Errorf("server %q: missing required field: command", name)
-		}
-		if srv.Default != "deny" && srv.Default != "allow" {
-			return fmt.Errorf("server %q: default must be \"deny\" or \"allow\", got %q", name, srv.Default)
-		}
-		for i, rule := range srv.Rules {
-			if rule.Tool == "" {
-				return fmt.Errorf("server %q: rule %d: missing required field: tool", name, i)
-			}
-		}
+	if len(errs) > 0 {
+		errs.Sort()
+		return nil, fmt.Errorf("invalid config: %w", errs)
 	}
-	return nil
+	return cfg, nil
 }
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// Resolve expands every server's extends and rule_sets references in place.
+// Afterwards each server's Rules hold its complete, ordered rule list and
+// its Extends and RuleSets fields are cleared.
+//
+// Merge semantics: a server inherits command, args, default,
+// aggregate_tool_list, protocol_versions and initialize from its template
+// unless it sets them itself; secrets.env maps are merged with the server's own keys taking
+// precedence. The effective rule list is the
+// server's own rules, then the rules of each referenced rule set in the
+// order listed, then the template's effective rules. Rules are evaluated
+// first-match-wins, so a server overrides inherited rules by declaring its own.
+func Resolve(cfg *Config) error {
+	r := &resolver{cfg: cfg, done: map[string]Server{}}
+	for _, name := range sortedServerNames(cfg.Servers) {
+		resolved, err := r.expand(cfg.Servers[name])
+		if err != nil {
+			return err
+		}
+		cfg.Servers[name] = resolved
+	}
+	return nil
+}
+
+// sortedServerNames returns the keys of servers in lexical order so that
+// errors are reported deterministically.
+func sortedServerNames(servers map[string]Server) []string {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type resolver struct {
+	cfg *Config
+	// done caches fully expanded templates.
+	done map[string]Server
+	// visiting holds the chain of templates currently being expanded.
+	visiting []string
+}
+
+// template returns the expanded template with the given name. from is the
+// position of the server or template that referenced it.
+func (r *resolver) template(name string, from Pos) (Server, error) {
+	if tmpl, ok := r.done[name]; ok {
+		return tmpl, nil
+	}
+	for i, v := range r.visiting {
+		if v == name {
+			cycle := append(append([]string{}, r.visiting[i:]...), name)
+			return Server{}, errorf(from, "template cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	tmpl, ok := r.cfg.Templates[name]
+	if !ok {
+		return Server{}, errorf(from, "extends unknown template %q", name)
+	}
+
+	r.visiting = append(r.visiting, name)
+	expanded, err := r.expand(tmpl)
+	r.visiting = r.visiting[:len(r.visiting)-1]
+	if err != nil {
+		return Server{}, err
+	}
+	r.done[name] = expanded
+	return expanded, nil
+}
+
+// expand returns srv with its rule sets and template merged in.
+func (r *resolver) expand(srv Server) (Server, error) {
+	rules := append([]Rule{}, srv.Rules...)
+	for _, name := range srv.RuleSets {
+		set, ok := r.cfg.RuleSets[name]
+		if !ok {
+			return Server{}, errorf(srv.pos, "unknown rule set %q", name)
+		}
+		rules = append(rules, set...)
+	}
+
+	out := srv
+	out.Rules = rules
+	out.RuleSets = nil
+	if srv.Extends == "" {
+		return out, nil
+	}
+
+	parent, err := r.template(srv.Extends, srv.pos)
+	if err != nil {
+		return Server{}, err
+	}
+	out.Extends = ""
+	return inherit(parent, out), nil
+}
+
+// inherit merges a fully expanded parent into child.
+func inherit(parent, child Server) Server {
+	out := child
+	if out.Command == "" {
+		out.Command = parent.Command
+	}
+	if out.Args == nil {
+		out.Args = parent.Args
+	}
+	if out.Default == "" {
+		out.Default = parent.Default
+	}
+	if out.AggregateToolList == nil {
+		out.AggregateToolList = parent.AggregateToolList
+	}
+	if out.ProtocolVersions == nil {
+		out.ProtocolVersions = parent.ProtocolVersions
+	}
+	if out.Initialize == nil {
+		out.Initialize = parent.Initialize
+	}
+	if parent.Secrets != nil {
+		env := make(map[string]string, len(parent.Secrets.Env))
+		for k, v := range parent.Secrets.Env {
+			env[k] = v
+		}
+		if child.Secrets != nil {
+			for k, v := range child.Secrets.Env {
+				env[k] = v
+			}
+		}
+		out.Secrets = &SecretsConfig{Env: env}
+	}
+	out.Rules = append(append([]Rule{}, child.Rules...), parent.Rules...)
+	// Inherited values are reported where the template set them.
+	out.fields = make(fieldPositions, len(parent.fields)+len(child.fields))
+	for k, p := range parent.fields {
+		out.fields[k] = p
+	}
+	for k, p := range child.fields {
+		out.fields[k] = p
+	}
+	return out
+}
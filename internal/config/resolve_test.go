@@ -0,0 +1,153 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveExtends(t *testing.T) {
+	cfg := &Config{
+		Version: "1",
+		RuleSets: map[string][]Rule{
+			"listing": {{Tool: "list_directory", Allow: true}},
+		},
+		Templates: map[string]Server{
+			"npx": {
+				Command:          "npx",
+				Args:             []string{"-y"},
+				Default:          "deny",
+				Secrets:          &SecretsConfig{Env: map[string]string{"A": "env:A", "B": "env:B"}},
+				Rules:            []Rule{{Tool: "read_file", Allow: true}},
+				ProtocolVersions: []string{"2025-06-18"},
+				Initialize:       &InitializeConfig{StripCapabilities: []string{"prompts"}},
+			},
+		},
+		Servers: map[string]Server{
+			"fs": {
+				Extends:  "npx",
+				Secrets:  &SecretsConfig{Env: map[string]string{"B": "env:OVERRIDE"}},
+				RuleSets: []string{"listing"},
+				Rules:    []Rule{{Tool: "read_file", Allow: false, When: map[string]string{"path": "/secret/**"}}},
+			},
+		},
+	}
+	if err := Resolve(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv := cfg.Servers["fs"]
+	if srv.Command != "npx" || srv.Default != "deny" || len(srv.Args) != 1 {
+		t.Errorf("inherited fields not merged: %+v", srv)
+	}
+	if srv.Initialize == nil || srv.Initialize.StripCapabilities[0] != "prompts" || len(srv.ProtocolVersions) != 1 {
+		t.Errorf("initialize and protocol_versions not inherited: %+v", srv)
+	}
+	if srv.Extends != "" || srv.RuleSets != nil {
+		t.Errorf("references should be cleared after resolution: %+v", srv)
+	}
+	if srv.Secrets.Env["A"] != "env:A" || srv.Secrets.Env["B"] != "env:OVERRIDE" {
+		t.Errorf("secrets.env = %v, want merged with server keys winning", srv.Secrets.Env)
+	}
+
+	// Own rules, then rule sets, then template rules.
+	want := []string{"read_file", "list_directory", "read_file"}
+	if len(srv.Rules) != len(want) {
+		t.Fatalf("rules = %+v, want %v", srv.Rules, want)
+	}
+	for i, tool := range want {
+		if srv.Rules[i].Tool != tool {
+			t.Errorf("rule %d tool = %q, want %q", i, srv.Rules[i].Tool, tool)
+		}
+	}
+	if srv.Rules[0].Allow {
+		t.Error("server's own deny rule should come before the template's allow rule")
+	}
+}
+
+func TestResolveAggregateToolListOverride(t *testing.T) {
+	on, off := true, false
+	cfg := &Config{
+		Version: "1",
+		Templates: map[string]Server{
+			"base": {Command: "fs", Default: "deny", AggregateToolList: &on},
+		},
+		Servers: map[string]Server{
+			"inherits": {Extends: "base"},
+			"disables": {Extends: "base", AggregateToolList: &off},
+		},
+	}
+	if err := Resolve(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Servers["inherits"].AggregatesToolList() {
+		t.Error("aggregate_tool_list not inherited from the template")
+	}
+	if cfg.Servers["disables"].AggregatesToolList() {
+		t.Error("explicit aggregate_tool_list: false did not override the template")
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{
+			name: "unknown template",
+			cfg: Config{Servers: map[string]Server{
+				"s": {Extends: "missing"},
+			}},
+			wantErr: `unknown template "missing"`,
+		},
+		{
+			name: "unknown rule set",
+			cfg: Config{Servers: map[string]Server{
+				"s": {RuleSets: []string{"missing"}},
+			}},
+			wantErr: `unknown rule set "missing"`,
+		},
+		{
+			name: "template cycle",
+			cfg: Config{
+				Templates: map[string]Server{
+					"a": {Extends: "b"},
+					"b": {Extends: "a"},
+				},
+				Servers: map[string]Server{"s": {Extends: "a"}},
+			},
+			wantErr: "template cycle: a -> b -> a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Resolve(&tt.cfg)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadTemplateCyclePosition(t *testing.T) {
+	path := writeTempFile(t, `version: "1"
+templates:
+  a:
+    extends: b
+  b:
+    extends: a
+servers:
+  s:
+    extends: a
+`)
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for template cycle")
+	}
+	if !strings.Contains(err.Error(), "test.yaml:5:3: template cycle") {
+		t.Errorf("error = %v, want cycle reported at template b", err)
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// schemaHints holds the constraints and descriptions that cannot be derived
+// from the Go types alone, keyed by "Type.yaml_key".
+var schemaHints = map[string]map[string]any{
+	"Config.version":   {"description": "Policy file format version.", "minLength": 1},
+	"Config.include":   {"description": "Policy files or directories to merge in, relative to this file."},
+	"Config.vault":     {"description": "HashiCorp Vault connection used to resolve vault: secret references."},
+	"Config.rule_sets": {"description": "Named rule lists that servers reference with rule_sets."},
+	"Config.templates": {"description": "Server templates that servers inherit from with extends."},
+	"Config.audit":     {"description": "Audit log file location, rotation, retention and signing."},
+	"Config.servers":   {"description": "MCP servers keyed by the name passed to constellation run --server."},
+
+	"AuditConfig.path":         {"description": "Audit log file. The --audit-log flag takes precedence."},
+	"AuditConfig.max_size_mb":  {"description": "Rotate the log before it grows past this many megabytes.", "minimum": 0},
+	"AuditConfig.rotate_every": {"description": "Rotate the log after it has been open this long, e.g. 24h."},
+	"AuditConfig.compress":     {"description": "Gzip rotated log files."},
+	"AuditConfig.max_files":    {"description": "Number of rotated files to keep.", "minimum": 0},
+	"AuditConfig.max_age":      {"description": "Remove rotated files older than this, e.g. 720h."},
+
+	"AuditConfig.queue_size":      {"description": "Records buffered between tool calls and the sinks (default 1024).", "minimum": 0},
+	"AuditConfig.overflow":        {"description": "What to do when the queue is full: wait, drop the record, or deny the call.", "enum": []any{"block", "drop", "fail_closed"}},
+	"AuditConfig.result_body":     {"description": "How much of each tool result body to record: none, the scrubbed body truncated to result_body_max, or its SHA-256.", "enum": []any{"none", "truncate", "hash"}},
+	"AuditConfig.result_body_max": {"description": "Bytes of a truncated result body to keep (default 4096).", "minimum": 0},
+	"AuditConfig.redact":          {"description": "Redaction of tool call arguments. Resolved secret values are always redacted."},
+
+	"RedactConfig.keys":             {"description": "Case-insensitive globs for argument names or dotted paths whose values are redacted, e.g. *password*."},
+	"RedactConfig.values":           {"description": "Regular expressions for parts of values to redact."},
+	"RedactConfig.detect_secrets":   {"description": "Redact recognised credential formats: cloud keys, API tokens, JWTs, private keys."},
+	"RedactConfig.max_value_length": {"description": "Truncate longer string values.", "minimum": 0},
+	"RedactConfig.hash":             {"description": "Append a digest of each redacted or truncated value for correlation."},
+	"RedactConfig.hash_salt":        {"description": "Key for the digest HMAC, e.g. ${AUDIT_HASH_SALT}."},
+
+	"AuditConfig.sinks": {"description": "Additional destinations every audit record is copied to."},
+
+	"SinkConfig.type":           {"description": "Sink kind.", "enum": []any{"file", "stderr", "syslog", "webhook", "otlp"}},
+	"SinkConfig.path":           {"description": "file: log file path, rotated like audit.path."},
+	"SinkConfig.network":        {"description": "syslog: transport.", "enum": []any{"unix", "udp", "tcp"}},
+	"SinkConfig.address":        {"description": "syslog: host:port, or a socket path for unix."},
+	"SinkConfig.facility":       {"description": "syslog: facility (default local0).", "enum": facilityEnum()},
+	"SinkConfig.app_name":       {"description": "syslog: APP-NAME field (default constellation)."},
+	"SinkConfig.url":            {"description": "webhook: URL to POST JSON arrays of records to. otlp: collector endpoint, e.g. http://localhost:4318."},
+	"SinkConfig.headers":        {"description": "webhook, otlp: extra HTTP request headers."},
+	"SinkConfig.buffer_size":    {"description": "Records queued before new ones are dropped (default 10000).", "minimum": 0},
+	"SinkConfig.batch_size":     {"description": "Records per delivery (default 100).", "minimum": 0},
+	"SinkConfig.flush_interval": {"description": "Deliver a partial batch after this long (default 5s)."},
+	"SinkConfig.max_retries":    {"description": "Retries for a failed delivery before it is dropped; defaults to 3, and 0 disables retries.", "minimum": 0},
+	"SinkConfig.timeout":        {"description": "Timeout for each delivery attempt (default 10s)."},
+
+	"VaultConfig.address": {"description": "Vault server URL.", "minLength": 1},
+	"AuthConfig.method":   {"description": "Vault auth method.", "enum": []any{"token", "approle"}},
+
+	"Server.extends":             {"description": "Name of a template to inherit command, args, default, secrets and rules from."},
+	"Server.command":             {"description": "Executable that starts the MCP server.", "minLength": 1},
+	"Server.args":                {"description": "Arguments passed to command."},
+	"Server.default":             {"description": "Decision when no rule matches.", "enum": []any{"deny", "allow"}},
+	"Server.rule_sets":           {"description": "Rule sets appended after this server's own rules."},
+	"Server.rules":               {"description": "Rules evaluated top-down; the first match wins."},
+	"Server.aggregate_tool_list": {"description": "Fetch every page of the server's tools/list and answer clients with one policy-filtered list, cached until the server reports list_changed."},
+	"Server.protocol_versions":   {"description": "MCP protocol versions a session may negotiate, e.g. [\"2025-06-18\"]. Any version is accepted when unset.", "items": map[string]any{"type": "string", "pattern": `^\d{4}-\d{2}-\d{2}$`}},
+	"Server.initialize":          {"description": "Rewriting of the server's initialize response: capabilities, serverInfo and instructions."},
+
+	"InitializeConfig.strip_capabilities": {"description": "Capabilities hidden from the client; their requests and notifications are blocked.", "items": map[string]any{"type": "string", "enum": capabilityEnum()}},
+	"InitializeConfig.server_info":        {"description": "serverInfo fields reported instead of the server's own."},
+	"InitializeConfig.instructions":       {"description": "Filtering or replacement of the server's instructions."},
+
+	"InstructionsConfig.strip":   {"description": "Drop the server's instructions."},
+	"InstructionsConfig.replace": {"description": "Report these instructions instead of the server's."},
+	"InstructionsConfig.remove":  {"description": "Regular expressions whose matches are cut out of the instructions."},
+
+	"SecretsConfig.env": {"description": "Environment variables for the server process, as provider:reference strings."},
+
+	"Rule.tool":  {"description": "Tool name the rule applies to.", "minLength": 1},
+	"Rule.allow": {"description": "Whether a matching call is allowed."},
+	"Rule.when":  {"description": "Argument glob patterns that must all match."},
+}
+
+// Schema returns a JSON Schema (draft 2020-12) describing constellation.yaml.
+// It is generated from the Config types so that it cannot drift from what
+// Load accepts; unknown fields are rejected just as Load rejects them.
+func Schema() map[string]any {
+	g := &schemaGen{defs: map[string]any{}}
+	root := g.object(reflect.TypeOf(Config{}))
+
+	// A root file must name its version, and must define servers unless
+	// it pulls them in through include.
+	root["required"] = []any{"version"}
+	root["if"] = map[string]any{"not": map[string]any{"required": []any{"include"}}}
+	root["then"] = map[string]any{
+		"required":   []any{"servers"},
+		"properties": map[string]any{"servers": map[string]any{"minProperties": 1}},
+	}
+
+	// A server must say how to start it and what to do by default, either
+	// directly or by extending a template.
+	server := g.defs["Server"].(map[string]any)
+	server["anyOf"] = []any{
+		map[string]any{"required": []any{"extends"}},
+		map[string]any{"required": []any{"command", "default"}},
+	}
+	g.defs["Rule"].(map[string]any)["required"] = []any{"tool"}
+	g.defs["VaultConfig"].(map[string]any)["required"] = []any{"address", "auth"}
+	g.defs["AuthConfig"].(map[string]any)["required"] = []any{"method"}
+	g.defs["SinkConfig"].(map[string]any)["required"] = []any{"type"}
+
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "Constellation policy file"
+	root["$defs"] = g.defs
+	return root
+}
+
+// SchemaJSON returns the schema encoded as indented JSON.
+func SchemaJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func capabilityEnum() []any {
+	enum := make([]any, len(StrippableCapabilities))
+	for i, c := range StrippableCapabilities {
+		enum[i] = c
+	}
+	return enum
+}
+
+func facilityEnum() []any {
+	enum := make([]any, len(syslogFacilities))
+	for i, f := range syslogFacilities {
+		enum[i] = f
+	}
+	return enum
+}
+
+// durationPattern matches strings accepted by time.ParseDuration.
+const durationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+
+type schemaGen struct {
+	defs map[string]any
+}
+
+// schema returns the schema for t, registering named structs in $defs.
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // placeholder for recursive types
+			g.defs[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+// object builds the schema for a struct from its yaml-tagged fields.
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := yamlKey(f)
+		if !ok {
+			continue
+		}
+		prop := g.schema(f.Type)
+		for k, v := range schemaHints[t.Name()+"."+name] {
+			prop[k] = v
+		}
+		props[name] = prop
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"gopkg.in/yaml.v3"
+)
+
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+	data, err := SchemaJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("constellation.schema.json", doc); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := c.Compile("constellation.schema.json")
+	if err != nil {
+		t.Fatalf("schema does not compile: %v", err)
+	}
+	return schema
+}
+
+// yamlToJSON converts a policy file into the JSON value a schema validator
+// (or an editor) would check.
+func yamlToJSON(t *testing.T, path string) any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestSchemaAgreesWithValidate(t *testing.T) {
+	schema := compileSchema(t)
+
+	for _, dir := range []string{"valid", "invalid"} {
+		files, err := filepath.Glob(filepath.Join("testdata", "schema", dir, "*.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Fatalf("no fixtures in testdata/schema/%s", dir)
+		}
+		wantValid := dir == "valid"
+
+		for _, path := range files {
+			t.Run(dir+"/"+filepath.Base(path), func(t *testing.T) {
+				_, loadErr := Load(path)
+				schemaErr := schema.Validate(yamlToJSON(t, path))
+
+				if (loadErr == nil) != wantValid {
+					t.Errorf("Load() error = %v, want valid = %v", loadErr, wantValid)
+				}
+				if (schemaErr == nil) != wantValid {
+					t.Errorf("schema validation error = %v, want valid = %v", schemaErr, wantValid)
+				}
+			})
+		}
+	}
+}
+
+func TestSchemaFileUpToDate(t *testing.T) {
+	want, err := SchemaJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join("..", "..", "constellation.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("constellation.schema.json is stale; regenerate it with: go run ./cmd/constellation schema > constellation.schema.json")
+	}
+}
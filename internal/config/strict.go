@@ -0,0 +1,158 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkFields walks a parsed YAML node alongside the Go type it decodes
+// into and reports every mapping key that does not correspond to a field.
+// yaml.v3 silently drops unknown keys, which turns a typo such as "alow"
+// into a rule with allow: false.
+func checkFields(file string, n *yaml.Node, t reflect.Type, errs *ErrorList) {
+	if n == nil {
+		return
+	}
+	if n.Kind == yaml.AliasNode {
+		checkFields(file, n.Alias, t, errs)
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			if key.Value == "<<" {
+				checkFields(file, val, t, errs)
+				continue
+			}
+			ft, ok := fields[key.Value]
+			if !ok {
+				errs.Add(nodePos(file, key), "unknown field %q in %s%s", key.Value, typeName(t), suggest(key.Value, fields))
+				continue
+			}
+			checkFields(file, val, ft, errs)
+		}
+
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			checkFields(file, n.Content[i+1], t.Elem(), errs)
+		}
+
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, item := range n.Content {
+			checkFields(file, item, t.Elem(), errs)
+		}
+	}
+}
+
+// yamlFields maps the YAML keys accepted by a struct type to field types.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := yamlKey(t.Field(i)); ok {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+// yamlKey returns the YAML key a struct field decodes from, following the
+// same rules as yaml.v3. ok is false for fields yaml.v3 ignores.
+func yamlKey(f reflect.StructField) (name string, ok bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	name, _, _ = strings.Cut(f.Tag.Get("yaml"), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return strings.ToLower(f.Name), true
+	}
+	return name, true
+}
+
+// typeName describes a config struct for error messages, e.g. "rule".
+func typeName(t reflect.Type) string {
+	switch t {
+	case reflect.TypeOf(Config{}):
+		return "policy file"
+	case reflect.TypeOf(Server{}):
+		return "server"
+	case reflect.TypeOf(Rule{}):
+		return "rule"
+	case reflect.TypeOf(VaultConfig{}):
+		return "vault"
+	case reflect.TypeOf(TLSConfig{}):
+		return "vault.tls"
+	case reflect.TypeOf(AuthConfig{}):
+		return "vault.auth"
+	case reflect.TypeOf(SecretsConfig{}):
+		return "secrets"
+	case reflect.TypeOf(AuditConfig{}):
+		return "audit"
+	case reflect.TypeOf(RedactConfig{}):
+		return "audit.redact"
+	case reflect.TypeOf(SinkConfig{}):
+		return "audit sink"
+	}
+	return t.Name()
+}
+
+// suggest returns a "did you mean" hint for a misspelled key, if a known
+// key is within a small edit distance.
+func suggest(key string, fields map[string]reflect.Type) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best, bestDist := "", 3
+	for _, name := range names {
+		if d := editDistance(key, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return " (did you mean \"" + best + "\"?)"
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -1,10 +1,59 @@
 package config
 
+import "time"
+
 // Config is the top-level constellation.yaml structure.
 type Config struct {
-	Version string            `yaml:"version"`
-	Vault   *VaultConfig      `yaml:"vault,omitempty"`
-	Servers map[string]Server `yaml:"servers"`
+	Version   string            `yaml:"version"`
+	Include   []string          `yaml:"include,omitempty"`
+	Vault     *VaultConfig      `yaml:"vault,omitempty"`
+	Audit     *AuditConfig      `yaml:"audit,omitempty"`
+	RuleSets  map[string][]Rule `yaml:"rule_sets,omitempty"`
+	Templates map[string]Server `yaml:"templates,omitempty"`
+	Servers   map[string]Server `yaml:"servers"`
+
+	pos Pos
+}
+
+// RedactConfig selects argument values to redact from audit records.
+type RedactConfig struct {
+	// Keys are case-insensitive globs matched against argument names and
+	// dotted paths such as headers.authorization.
+	Keys []string `yaml:"keys,omitempty"`
+	// Values are regular expressions for parts of values to redact.
+	Values []string `yaml:"values,omitempty"`
+	// DetectSecrets redacts recognised credential formats.
+	DetectSecrets  bool   `yaml:"detect_secrets,omitempty"`
+	MaxValueLength int    `yaml:"max_value_length,omitempty"`
+	Hash           bool   `yaml:"hash,omitempty"`
+	HashSalt       string `yaml:"hash_salt,omitempty"`
+}
+
+// SinkConfig describes one additional audit destination. Which fields
+// apply depends on Type: file uses Path; syslog uses Network, Address,
+// Facility and AppName; webhook and otlp use URL and Headers. The
+// batching fields apply to syslog, webhook and otlp.
+type SinkConfig struct {
+	Type     string            `yaml:"type"`
+	Path     string            `yaml:"path,omitempty"`
+	Network  string            `yaml:"network,omitempty"`
+	Address  string            `yaml:"address,omitempty"`
+	Facility string            `yaml:"facility,omitempty"`
+	AppName  string            `yaml:"app_name,omitempty"`
+	URL      string            `yaml:"url,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+
+	// Delivery settings for network sinks. Unset values take the audit
+	// package's defaults; an unset MaxRetries means 3 and 0 disables
+	// retries.
+	BufferSize    int           `yaml:"buffer_size,omitempty"`
+	BatchSize     int           `yaml:"batch_size,omitempty"`
+	FlushInterval time.Duration `yaml:"flush_interval,omitempty"`
+	MaxRetries    *int          `yaml:"max_retries,omitempty"`
+	Timeout       time.Duration `yaml:"timeout,omitempty"`
+
+	pos    Pos
+	fields fieldPositions
 }
 
 // VaultConfig holds Vault connection and auth settings.
@@ -12,6 +61,45 @@ type VaultConfig struct {
 	Address string     `yaml:"address"`
 	TLS     TLSConfig  `yaml:"tls,omitempty"`
 	Auth    AuthConfig `yaml:"auth"`
+
+	pos    Pos
+	fields fieldPositions
+}
+
+// AuditConfig controls the audit log file and its rotation. The
+// --audit-log flag overrides Path.
+type AuditConfig struct {
+	Path string `yaml:"path,omitempty"`
+	// MaxSizeMB rotates the log before it grows past this size.
+	MaxSizeMB int `yaml:"max_size_mb,omitempty"`
+	// RotateEvery rotates the log after it has been open this long.
+	RotateEvery time.Duration `yaml:"rotate_every,omitempty"`
+	// Compress gzips rotated files.
+	Compress bool `yaml:"compress,omitempty"`
+	// MaxFiles and MaxAge bound how many rotated files are kept.
+	MaxFiles int           `yaml:"max_files,omitempty"`
+	MaxAge   time.Duration `yaml:"max_age,omitempty"`
+	// SigningKey is a PEM Ed25519 private key used to sign checkpoints
+	// of the record hash chain, written every CheckpointEvery records.
+	SigningKey      string `yaml:"signing_key,omitempty"`
+	CheckpointEvery int    `yaml:"checkpoint_every,omitempty"`
+	// QueueSize bounds how many records wait to be written; Overflow is
+	// block, drop or fail_closed and decides what happens when it is full.
+	QueueSize int    `yaml:"queue_size,omitempty"`
+	Overflow  string `yaml:"overflow,omitempty"`
+	// ResultBody is none, truncate or hash and decides how much of each
+	// tool result body is recorded; truncated bodies are cut to
+	// ResultBodyMax bytes.
+	ResultBody    string `yaml:"result_body,omitempty"`
+	ResultBodyMax int    `yaml:"result_body_max,omitempty"`
+	// Redact controls what is removed from tool call arguments before they
+	// are logged. Resolved secret values are always removed.
+	Redact *RedactConfig `yaml:"redact,omitempty"`
+	// Sinks are additional destinations every record is copied to.
+	Sinks []SinkConfig `yaml:"sinks,omitempty"`
+
+	pos    Pos
+	fields fieldPositions
 }
 
 type TLSConfig struct {
@@ -25,15 +113,74 @@ type AuthConfig struct {
 	SecretIDPath string `yaml:"secret_id_path,omitempty"`
 }
 
-// Server defines an MCP server and its access policy.
+// Server defines an MCP server and its access policy. The same structure
+// is used for entries under templates, which servers can inherit from
+// with extends.
 type Server struct {
-	Command string         `yaml:"command"`
-	Args    []string       `yaml:"args,omitempty"`
-	Secrets *SecretsConfig `yaml:"secrets,omitempty"`
-	Default string         `yaml:"default"`
-	Rules   []Rule         `yaml:"rules,omitempty"`
+	Extends  string         `yaml:"extends,omitempty"`
+	Command  string         `yaml:"command"`
+	Args     []string       `yaml:"args,omitempty"`
+	Secrets  *SecretsConfig `yaml:"secrets,omitempty"`
+	Default  string         `yaml:"default"`
+	RuleSets []string       `yaml:"rule_sets,omitempty"`
+	Rules    []Rule         `yaml:"rules,omitempty"`
+	// AggregateToolList answers tools/list with every page of the server's
+	// tools in one policy-filtered list, cached for the session. It is a
+	// pointer so that a server can turn off its template's setting.
+	AggregateToolList *bool `yaml:"aggregate_tool_list,omitempty"`
+	// ProtocolVersions allowlists the MCP protocol versions a session may
+	// negotiate; any version is accepted when it is empty.
+	ProtocolVersions []string `yaml:"protocol_versions,omitempty"`
+	// Initialize rewrites the server's answer to the initialize request.
+	Initialize *InitializeConfig `yaml:"initialize,omitempty"`
+
+	pos    Pos
+	fields fieldPositions
 }
 
+// Source returns where the server was defined, if it was loaded from a file.
+func (s Server) Source() Pos {
+	return s.pos
+}
+
+// AggregatesToolList reports whether aggregate_tool_list is enabled.
+func (s Server) AggregatesToolList() bool {
+	return s.AggregateToolList != nil && *s.AggregateToolList
+}
+
+// InitializeConfig controls what the client learns about the server when
+// the session is initialized.
+type InitializeConfig struct {
+	// StripCapabilities are resources, prompts, logging or completions.
+	// They are removed from the advertised capabilities, and requests and
+	// notifications that belong to them are blocked.
+	StripCapabilities []string `yaml:"strip_capabilities,omitempty"`
+	// ServerInfo replaces the non-empty fields of the server's serverInfo.
+	ServerInfo *ServerInfoConfig `yaml:"server_info,omitempty"`
+	// Instructions filters or replaces the server's instructions, which
+	// the client may pass to the model.
+	Instructions *InstructionsConfig `yaml:"instructions,omitempty"`
+}
+
+// ServerInfoConfig is the serverInfo reported to the client.
+type ServerInfoConfig struct {
+	Name    string `yaml:"name,omitempty"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// InstructionsConfig rewrites the server's instructions. Strip drops them
+// and Replace substitutes its own text; otherwise every match of the
+// Remove regular expressions is cut out.
+type InstructionsConfig struct {
+	Strip   bool     `yaml:"strip,omitempty"`
+	Replace string   `yaml:"replace,omitempty"`
+	Remove  []string `yaml:"remove,omitempty"`
+}
+
+// StrippableCapabilities are the capabilities initialize.strip_capabilities
+// accepts.
+var StrippableCapabilities = []string{"resources", "prompts", "logging", "completions"}
+
 type SecretsConfig struct {
 	Env map[string]string `yaml:"env,omitempty"`
 }
@@ -43,4 +190,14 @@ type Rule struct {
 	Tool  string            `yaml:"tool"`
 	Allow bool              `yaml:"allow"`
 	When  map[string]string `yaml:"when,omitempty"`
+
+	pos    Pos
+	fields fieldPositions
+}
+
+// Source returns where the rule was defined, if it was loaded from a file.
+// For rules inherited from a rule set or template this is the location of
+// the original definition.
+func (r Rule) Source() Pos {
+	return r.pos
 }
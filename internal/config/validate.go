@@ -0,0 +1,277 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Validate checks that a Config has all required fields and valid values.
+// Every problem is reported; the returned error is an ErrorList.
+func Validate(cfg *Config) error {
+	var errs ErrorList
+	if cfg.Version == "" {
+		errs.Add(cfg.pos, "missing required field: version")
+	}
+	if len(cfg.Servers) == 0 {
+		errs.Add(cfg.pos, "at least one server must be defined")
+	}
+	if v := cfg.Vault; v != nil {
+		if v.Address == "" {
+			errs.Add(v.pos, "vault: missing required field: address")
+		}
+		if v.Auth.Method != "token" && v.Auth.Method != "approle" {
+			errs.Add(v.fields.at("auth.method", v.pos), "vault: auth.method must be \"token\" or \"approle\", got %q", v.Auth.Method)
+		}
+	}
+	if a := cfg.Audit; a != nil {
+		checkNotNegative(&errs, "audit: ", a.fields, a.pos, []namedValue{
+			{"max_size_mb", int64(a.MaxSizeMB)},
+			{"rotate_every", int64(a.RotateEvery)},
+			{"max_files", int64(a.MaxFiles)},
+			{"max_age", int64(a.MaxAge)},
+			{"checkpoint_every", int64(a.CheckpointEvery)},
+			{"queue_size", int64(a.QueueSize)},
+			{"result_body_max", int64(a.ResultBodyMax)},
+		})
+		switch a.Overflow {
+		case "", "block", "drop", "fail_closed":
+		default:
+			errs.Add(a.fields.at("overflow", a.pos), "audit: overflow must be \"block\", \"drop\" or \"fail_closed\", got %q", a.Overflow)
+		}
+		switch a.ResultBody {
+		case "", "none", "truncate", "hash":
+		default:
+			errs.Add(a.fields.at("result_body", a.pos), "audit: result_body must be \"none\", \"truncate\" or \"hash\", got %q", a.ResultBody)
+		}
+		if r := a.Redact; r != nil {
+			for i, k := range r.Keys {
+				if _, err := path.Match(strings.ToLower(k), ""); err != nil {
+					errs.Add(a.fields.at(fmt.Sprintf("redact.keys[%d]", i), a.pos), "audit: redact.keys: invalid pattern %q", k)
+				}
+			}
+			for i, v := range r.Values {
+				if _, err := regexp.Compile(v); err != nil {
+					errs.Add(a.fields.at(fmt.Sprintf("redact.values[%d]", i), a.pos), "audit: redact.values: %v", err)
+				}
+			}
+			if r.MaxValueLength < 0 {
+				errs.Add(a.fields.at("redact.max_value_length", a.pos), "audit: redact.max_value_length must not be negative")
+			}
+		}
+		for i, sink := range a.Sinks {
+			validateSink(i, sink, &errs)
+		}
+	}
+	for _, name := range sortedServerNames(cfg.Servers) {
+		srv := cfg.Servers[name]
+		if srv.Command == "" {
+			errs.Add(srv.pos, "server %q: missing required field: command", name)
+		}
+		if srv.Default != "deny" && srv.Default != "allow" {
+			errs.Add(srv.fields.at("default", srv.pos), "server %q: default must be \"deny\" or \"allow\", got %q", name, srv.Default)
+		}
+		for i, v := range srv.ProtocolVersions {
+			if !protocolVersionPattern.MatchString(v) {
+				errs.Add(srv.fields.at(fmt.Sprintf("protocol_versions[%d]", i), srv.pos), "server %q: protocol_versions: %q is not a protocol version such as \"2025-06-18\"", name, v)
+			}
+		}
+		if init := srv.Initialize; init != nil {
+			for i, c := range init.StripCapabilities {
+				if !slices.Contains(StrippableCapabilities, c) {
+					errs.Add(srv.fields.at(fmt.Sprintf("initialize.strip_capabilities[%d]", i), srv.pos), "server %q: initialize.strip_capabilities: unknown capability %q (want one of %s)", name, c, strings.Join(StrippableCapabilities, ", "))
+				}
+			}
+			if in := init.Instructions; in != nil {
+				if in.Strip && in.Replace != "" {
+					errs.Add(srv.fields.at("initialize.instructions", srv.pos), "server %q: initialize.instructions: strip and replace are mutually exclusive", name)
+				}
+				for i, re := range in.Remove {
+					if _, err := regexp.Compile(re); err != nil {
+						errs.Add(srv.fields.at(fmt.Sprintf("initialize.instructions.remove[%d]", i), srv.pos), "server %q: initialize.instructions.remove: %v", name, err)
+					}
+				}
+			}
+		}
+		for i, rule := range srv.Rules {
+			if rule.Tool == "" {
+				errs.Add(rule.pos, "server %q: rule %d: missing required field: tool", name, i)
+			}
+			for _, key := range sortedKeys(rule.When) {
+				if !doublestar.ValidatePattern(rule.When[key]) {
+					errs.Add(rule.fields.at("when."+key, rule.pos), "server %q: rule %d: when.%s: invalid glob pattern %q", name, i, key, rule.When[key])
+				}
+			}
+		}
+	}
+	errs.Sort()
+	return errs.Err()
+}
+
+// protocolVersionPattern matches MCP protocol versions, which are dates.
+var protocolVersionPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// syslogFacilities are the facility names a syslog sink accepts.
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+func validateSink(i int, s SinkConfig, errs *ErrorList) {
+	require := func(field, value string) {
+		if value == "" {
+			errs.Add(s.pos, "audit: sinks[%d]: %s sink requires %s", i, s.Type, field)
+		}
+	}
+	switch s.Type {
+	case "file":
+		require("path", s.Path)
+	case "stderr":
+	case "stdout":
+		// The proxy speaks MCP with its client on stdout; audit records
+		// there would corrupt the protocol stream.
+		errs.Add(s.fields.at("type", s.pos), "audit: sinks[%d]: stdout carries the proxy's MCP messages and cannot take audit records; use stderr", i)
+	case "syslog":
+		require("address", s.Address)
+		if s.Network != "unix" && s.Network != "udp" && s.Network != "tcp" {
+			errs.Add(s.fields.at("network", s.pos), "audit: sinks[%d]: network must be \"unix\", \"udp\" or \"tcp\", got %q", i, s.Network)
+		}
+		if s.Facility != "" && !slices.Contains(syslogFacilities, s.Facility) {
+			errs.Add(s.fields.at("facility", s.pos), "audit: sinks[%d]: unknown syslog facility %q", i, s.Facility)
+		}
+	case "webhook", "otlp":
+		require("url", s.URL)
+	default:
+		errs.Add(s.fields.at("type", s.pos), "audit: sinks[%d]: type must be file, stderr, syslog, webhook or otlp, got %q", i, s.Type)
+	}
+	var maxRetries int64
+	if s.MaxRetries != nil {
+		maxRetries = int64(*s.MaxRetries)
+	}
+	checkNotNegative(errs, fmt.Sprintf("audit: sinks[%d]: ", i), s.fields, s.pos, []namedValue{
+		{"buffer_size", int64(s.BufferSize)},
+		{"batch_size", int64(s.BatchSize)},
+		{"flush_interval", int64(s.FlushInterval)},
+		{"max_retries", maxRetries},
+		{"timeout", int64(s.Timeout)},
+	})
+}
+
+// namedValue is a numeric setting and the field it was read from.
+type namedValue struct {
+	field string
+	value int64
+}
+
+// checkNotNegative reports every negative value at the position of its
+// field.
+func checkNotNegative(errs *ErrorList, prefix string, fields fieldPositions, pos Pos, values []namedValue) {
+	for _, v := range values {
+		if v.value < 0 {
+			errs.Add(fields.at(v.field, pos), "%s%s must not be negative", prefix, v.field)
+		}
+	}
+}
+
+// Lint reports rules that are valid but almost certainly mistakes: rules
+// that can never match because an earlier rule for the same tool already
+// matches every call they would, and when clauses with an empty pattern,
+// which only match an empty argument.
+func Lint(cfg *Config) []Warning {
+	var warnings []Warning
+	for _, name := range sortedServerNames(cfg.Servers) {
+		srv := cfg.Servers[name]
+		for i, rule := range srv.Rules {
+			for j := 0; j < i; j++ {
+				if shadows(srv.Rules[j], rule) {
+					warnings = append(warnings, Warning{
+						Pos: rule.pos,
+						Msg: fmt.Sprintf("server %q: rule %d (tool %q) is unreachable: rule %d%s matches every call it would",
+							name, i, rule.Tool, j, atPos(srv.Rules[j].pos)),
+					})
+					break
+				}
+			}
+			for _, key := range sortedKeys(rule.When) {
+				if rule.When[key] == "" {
+					warnings = append(warnings, Warning{
+						Pos: rule.pos,
+						Msg: fmt.Sprintf("server %q: rule %d: when.%s is empty and only matches an empty argument", name, i, key),
+					})
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// CheckExposedTools warns about allow rules for tools that are not in the
+// list the server actually advertises. Such rules usually mean the tool
+// name is misspelled or the server was upgraded and renamed it.
+func CheckExposedTools(name string, srv Server, tools []string) []Warning {
+	exposed := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		exposed[t] = true
+	}
+	var warnings []Warning
+	for i, rule := range srv.Rules {
+		if rule.Allow && !exposed[rule.Tool] {
+			warnings = append(warnings, Warning{
+				Pos: rule.pos,
+				Msg: fmt.Sprintf("server %q: rule %d allows tool %q, which the server does not expose", name, i, rule.Tool),
+			})
+		}
+	}
+	return warnings
+}
+
+// shadows reports whether every call matched by later is also matched by
+// earlier. It is conservative: it only recognises identical patterns, the
+// match-everything pattern "**", and literal patterns in later that the
+// earlier glob matches.
+func shadows(earlier, later Rule) bool {
+	if earlier.Tool != later.Tool {
+		return false
+	}
+	for key, pattern := range earlier.When {
+		other, ok := later.When[key]
+		if !ok {
+			return false
+		}
+		switch {
+		case pattern == other, pattern == "**":
+		case !hasMeta(other):
+			if ok, err := doublestar.Match(pattern, other); err != nil || !ok {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[{\`)
+}
+
+func atPos(pos Pos) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	return " at " + pos.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoadUnknownFields(t *testing.T) {
+	path := writeTempFile(t, `version: "1"
+servers:
+  fs:
+    command: "fs"
+    default: deny
+    rules:
+      - tool: read_file
+        alow: true
+      - tool: write_file
+        allow: true
+        wen:
+          path: "/tmp/**"
+`)
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown fields")
+	}
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error = %T, want ErrorList", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d errors, want 2: %v", len(list), err)
+	}
+	if !strings.HasSuffix(list[0].Pos.String(), "test.yaml:8:9") || !strings.Contains(list[0].Msg, `did you mean "allow"`) {
+		t.Errorf("error 0 = %v, want alow at 8:9 with suggestion", list[0])
+	}
+	if !strings.HasSuffix(list[1].Pos.String(), "test.yaml:11:9") || !strings.Contains(list[1].Msg, `did you mean "when"`) {
+		t.Errorf("error 1 = %v, want wen at 11:9 with suggestion", list[1])
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	path := writeTempFile(t, `servers:
+  a:
+    default: maybe
+  b:
+    command: "b"
+    default: deny
+    rules:
+      - allow: true
+      - tool: read_file
+        allow: true
+        when:
+          path: "/tmp/[unclosed"
+`)
+	_, err := Load(path)
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error = %v, want ErrorList", err)
+	}
+	want := []string{
+		"test.yaml:1:1: missing required field: version",
+		`test.yaml:2:3: server "a": missing required field: command`,
+		`test.yaml:3:5: server "a": default must be`,
+		`test.yaml:8:9: server "b": rule 0: missing required field: tool`,
+		`test.yaml:12:11: server "b": rule 1: when.path: invalid glob pattern`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(list), len(want), err)
+	}
+	for i, w := range want {
+		if !strings.Contains(list[i].Error(), w) {
+			t.Errorf("error %d = %q, want it to contain %q", i, list[i].Error(), w)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	cfg := &Config{
+		Version: "1",
+		Servers: map[string]Server{
+			"fs": {
+				Command: "fs",
+				Default: "deny",
+				Rules: []Rule{
+					{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**"}},
+					{Tool: "read_file", Allow: false, When: map[string]string{"path": "/public/secret.txt"}},
+					{Tool: "list_directory", Allow: true},
+					{Tool: "list_directory", Allow: false, When: map[string]string{"path": "/etc/**"}},
+					{Tool: "write_file", Allow: true, When: map[string]string{"path": "/tmp/*"}},
+					{Tool: "write_file", Allow: true, When: map[string]string{"path": "/tmp/**"}},
+					{Tool: "search", Allow: true, When: map[string]string{"query": ""}},
+				},
+			},
+		},
+	}
+	warnings := Lint(cfg)
+	want := []string{
+		"rule 1 (tool \"read_file\") is unreachable: rule 0",
+		"rule 3 (tool \"list_directory\") is unreachable: rule 2",
+		"rule 6: when.query is empty",
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("got %d warnings, want %d: %v", len(warnings), len(want), warnings)
+	}
+	for i, w := range want {
+		if !strings.Contains(warnings[i].String(), w) {
+			t.Errorf("warning %d = %q, want it to contain %q", i, warnings[i], w)
+		}
+	}
+}
+
+func TestCheckExposedTools(t *testing.T) {
+	srv := Server{
+		Rules: []Rule{
+			{Tool: "read_file", Allow: true},
+			{Tool: "raed_file", Allow: true},
+			{Tool: "delete_file", Allow: false},
+		},
+	}
+	warnings := CheckExposedTools("fs", srv, []string{"read_file", "write_file"})
+	if len(warnings) != 1 {
+		t.Fatalf("got %d warnings, want 1: %v", len(warnings), warnings)
+	}
+	if !strings.Contains(warnings[0].Msg, `"raed_file"`) {
+		t.Errorf("warning = %q, want it to name raed_file", warnings[0].Msg)
+	}
+}
+
+func TestValidateAuditSinks(t *testing.T) {
+	path := writeTempFile(t, `version: "1"
+audit:
+  sinks:
+    - type: syslog
+      network: tls
+      address: "logs:6514"
+    - type: webhook
+    - type: syslog
+      network: udp
+      address: "logs:514"
+      facility: local9
+    - type: stdout
+servers:
+  fs:
+    command: fs
+    default: deny
+`)
+	_, err := Load(path)
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error = %v, want ErrorList", err)
+	}
+	want := []string{
+		`test.yaml:5:7: audit: sinks[0]: network must be`,
+		`test.yaml:7:7: audit: sinks[1]: webhook sink requires url`,
+		`test.yaml:11:7: audit: sinks[2]: unknown syslog facility "local9"`,
+		`test.yaml:12:7: audit: sinks[3]: stdout carries the proxy's MCP messages`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(list), len(want), err)
+	}
+	for i, w := range want {
+		if !strings.Contains(list[i].Error(), w) {
+			t.Errorf("error %d = %q, want it to contain %q", i, list[i].Error(), w)
+		}
+	}
+}
+
+func TestValidateAuditFields(t *testing.T) {
+	path := writeTempFile(t, `version: "1"
+audit:
+  max_size_mb: 10
+  max_files: -1
+  overflow: spill
+  redact:
+    keys: ["token", "[unclosed"]
+  sinks:
+    - type: webhook
+      url: "https://siem.example.com/ingest"
+      timeout: -5s
+servers:
+  fs:
+    command: fs
+    default: deny
+`)
+	_, err := Load(path)
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error = %v, want ErrorList", err)
+	}
+	want := []string{
+		`test.yaml:4:3: audit: max_files must not be negative`,
+		`test.yaml:5:3: audit: overflow must be`,
+		`test.yaml:7:21: audit: redact.keys: invalid pattern "[unclosed"`,
+		`test.yaml:11:7: audit: sinks[0]: timeout must not be negative`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(list), len(want), err)
+	}
+	for i, w := range want {
+		if !strings.Contains(list[i].Error(), w) {
+			t.Errorf("error %d = %q, want it to contain %q", i, list[i].Error(), w)
+		}
+	}
+}
+
+func TestValidateInitialize(t *testing.T) {
+	path := writeTempFile(t, `version: "1"
+servers:
+  fs:
+    command: fs
+    default: deny
+    initialize:
+      strip_capabilities: [prompts, tools]
+      instructions:
+        strip: true
+        replace: "Use read_file."
+        remove: ["(unclosed"]
+`)
+	_, err := Load(path)
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error = %v, want ErrorList", err)
+	}
+	want := []string{
+		`test.yaml:7:37: server "fs": initialize.strip_capabilities: unknown capability "tools"`,
+		`test.yaml:8:7: server "fs": initialize.instructions: strip and replace are mutually exclusive`,
+		`test.yaml:11:18: server "fs": initialize.instructions.remove: error parsing regexp`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(list), len(want), err)
+	}
+	for i, w := range want {
+		if !strings.Contains(list[i].Error(), w) {
+			t.Errorf("error %d = %q, want it to contain %q", i, list[i].Error(), w)
+		}
+	}
+}
+
+func TestValidateProtocolVersions(t *testing.T) {
+	path := writeTempFile(t, `version: "1"
+servers:
+  fs:
+    command: fs
+    default: deny
+    protocol_versions: ["2025-06-18", "v1", "2025-6-18"]
+`)
+	_, err := Load(path)
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error = %v, want ErrorList", err)
+	}
+	want := []string{
+		`test.yaml:6:39: server "fs": protocol_versions: "v1" is not a protocol version`,
+		`test.yaml:6:45: server "fs": protocol_versions: "2025-6-18" is not a protocol version`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(list), len(want), err)
+	}
+	for i, w := range want {
+		if !strings.Contains(list[i].Error(), w) {
+			t.Errorf("error %d = %q, want it to contain %q", i, list[i].Error(), w)
+		}
+	}
+}
+
+func TestValidateInheritedFieldPosition(t *testing.T) {
+	path := writeTempFile(t, `version: "1"
+templates:
+  base:
+    command: fs
+    default: maybe
+servers:
+  fs:
+    extends: base
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), `test.yaml:5:5: server "fs": default must be`) {
+		t.Errorf("error = %v, want it at the template's default", err)
+	}
+}
@@ -0,0 +1,141 @@
+package coverage
+
+import (
+	"sort"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+)
+
+// Report summarizes how a policy's rules were exercised by logged calls.
+type Report struct {
+	Servers []ServerReport
+}
+
+// ServerReport is the coverage of one server's rules.
+type ServerReport struct {
+	Name  string
+	Calls int
+	// Rules has one entry per rule in policy order.
+	Rules []RuleCoverage
+	// DefaultDenials counts, per tool, calls that no rule matched and that
+	// the default denied.
+	DefaultDenials []ToolCount
+	// Unruled counts calls to tools that no rule names at all.
+	Unruled []ToolCount
+	// Stale counts records whose matched_rule does not exist in the
+	// current policy, which happens when rules were removed since the log
+	// was written.
+	Stale int
+}
+
+// RuleCoverage is the number of calls decided by one rule.
+type RuleCoverage struct {
+	Index int
+	Rule  config.Rule
+	Hits  int
+}
+
+// ToolCount is a per-tool call count.
+type ToolCount struct {
+	Tool  string
+	Count int
+}
+
+// Unused returns the rules that never decided a call.
+func (s ServerReport) Unused() []RuleCoverage {
+	var out []RuleCoverage
+	for _, r := range s.Rules {
+		if r.Hits == 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Analyze attributes each logged tool call to the rule that decided it.
+// By default it trusts the matched_rule index recorded in the log. With
+// reevaluate set, each call is instead evaluated against cfg, which gives
+// accurate results when the policy has changed since the log was written.
+// Calls for servers not in cfg are ignored.
+func Analyze(cfg *config.Config, calls []audit.ToolCallEvent, reevaluate bool) *Report {
+	type acc struct {
+		report   ServerReport
+		engine   *policy.Engine
+		ruled    map[string]bool
+		defaults map[string]int
+		unruled  map[string]int
+	}
+	servers := map[string]*acc{}
+	for name, srv := range cfg.Servers {
+		a := &acc{
+			report:   ServerReport{Name: name},
+			engine:   policy.NewEngine(srv),
+			ruled:    map[string]bool{},
+			defaults: map[string]int{},
+			unruled:  map[string]int{},
+		}
+		for i, rule := range srv.Rules {
+			a.report.Rules = append(a.report.Rules, RuleCoverage{Index: i, Rule: rule})
+			a.ruled[rule.Tool] = true
+		}
+		servers[name] = a
+	}
+
+	for _, c := range calls {
+		a, ok := servers[c.Server]
+		if !ok {
+			continue
+		}
+		a.report.Calls++
+
+		matched, denied := c.Rule, c.Decision == "deny"
+		if reevaluate {
+			d := a.engine.Evaluate(c.Tool, c.Arguments)
+			matched, denied = d.MatchedRule, !d.Allow
+		}
+
+		switch {
+		case matched >= len(a.report.Rules):
+			a.report.Stale++
+		case matched >= 0:
+			a.report.Rules[matched].Hits++
+		case denied:
+			a.defaults[c.Tool]++
+		}
+		if !a.ruled[c.Tool] {
+			a.unruled[c.Tool]++
+		}
+	}
+
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &Report{}
+	for _, name := range names {
+		a := servers[name]
+		a.report.DefaultDenials = sortedCounts(a.defaults)
+		a.report.Unruled = sortedCounts(a.unruled)
+		report.Servers = append(report.Servers, a.report)
+	}
+	return report
+}
+
+// sortedCounts orders counts by descending count, then tool name.
+func sortedCounts(m map[string]int) []ToolCount {
+	out := make([]ToolCount, 0, len(m))
+	for tool, n := range m {
+		out = append(out, ToolCount{Tool: tool, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Tool < out[j].Tool
+	})
+	return out
+}
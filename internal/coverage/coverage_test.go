@@ -0,0 +1,74 @@
+package coverage
+
+import (
+	"testing"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Servers: map[string]config.Server{
+			"fs": {
+				Default: "deny",
+				Rules: []config.Rule{
+					{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**"}},
+					{Tool: "write_file", Allow: true, When: map[string]string{"path": "/tmp/**"}},
+					{Tool: "list_directory", Allow: true},
+				},
+			},
+		},
+	}
+}
+
+func TestAnalyzeRecordedIndexes(t *testing.T) {
+	calls := []audit.ToolCallEvent{
+		{Server: "fs", Tool: "read_file", Decision: "allow", Rule: 0},
+		{Server: "fs", Tool: "read_file", Decision: "allow", Rule: 0},
+		{Server: "fs", Tool: "list_directory", Decision: "allow", Rule: 2},
+		{Server: "fs", Tool: "read_file", Decision: "deny", Rule: -1},
+		{Server: "fs", Tool: "delete_file", Decision: "deny", Rule: -1},
+		{Server: "fs", Tool: "delete_file", Decision: "deny", Rule: -1},
+		{Server: "fs", Tool: "read_file", Decision: "allow", Rule: 7},
+		{Server: "db", Tool: "query", Decision: "allow", Rule: 0},
+	}
+	report := Analyze(testConfig(), calls, false)
+	if len(report.Servers) != 1 {
+		t.Fatalf("servers = %d, want 1", len(report.Servers))
+	}
+	s := report.Servers[0]
+
+	if s.Calls != 7 {
+		t.Errorf("calls = %d, want 7", s.Calls)
+	}
+	hits := []int{2, 0, 1}
+	for i, want := range hits {
+		if s.Rules[i].Hits != want {
+			t.Errorf("rule %d hits = %d, want %d", i, s.Rules[i].Hits, want)
+		}
+	}
+	if unused := s.Unused(); len(unused) != 1 || unused[0].Index != 1 {
+		t.Errorf("unused = %+v, want rule 1", unused)
+	}
+	if len(s.DefaultDenials) != 2 || s.DefaultDenials[0] != (ToolCount{"delete_file", 2}) || s.DefaultDenials[1] != (ToolCount{"read_file", 1}) {
+		t.Errorf("default denials = %+v", s.DefaultDenials)
+	}
+	if len(s.Unruled) != 1 || s.Unruled[0] != (ToolCount{"delete_file", 2}) {
+		t.Errorf("unruled = %+v, want delete_file x2", s.Unruled)
+	}
+	if s.Stale != 1 {
+		t.Errorf("stale = %d, want 1", s.Stale)
+	}
+}
+
+func TestAnalyzeReevaluate(t *testing.T) {
+	// Logged against an older policy where write_file was rule 0.
+	calls := []audit.ToolCallEvent{
+		{Server: "fs", Tool: "write_file", Arguments: map[string]any{"path": "/tmp/x"}, Decision: "allow", Rule: 0},
+	}
+	s := Analyze(testConfig(), calls, true).Servers[0]
+	if s.Rules[0].Hits != 0 || s.Rules[1].Hits != 1 {
+		t.Errorf("hits = %d, %d, want the call attributed to rule 1", s.Rules[0].Hits, s.Rules[1].Hits)
+	}
+}
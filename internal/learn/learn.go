@@ -0,0 +1,252 @@
+package learn
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+)
+
+// Recorder collects the tool calls seen by a proxy so that a policy can be
+// proposed from them. It implements io.Writer so it can be teed onto the
+// audit log and consume the tool_call records the proxy already writes.
+type Recorder struct {
+	mu      sync.Mutex
+	server  string
+	partial []byte
+	calls   []audit.ToolCallEvent
+}
+
+// NewRecorder creates a Recorder that keeps tool calls for the named
+// server. An empty name keeps calls for every server.
+func NewRecorder(server string) *Recorder {
+	return &Recorder{server: server}
+}
+
+// Write consumes JSONL audit output. Records that are not tool calls are
+// ignored.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.partial = append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i < 0 {
+			break
+		}
+		r.record(r.partial[:i])
+		r.partial = r.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// ReadLog consumes an existing audit log.
+func (r *Recorder) ReadLog(rd io.Reader) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return audit.ReadRecords(rd, func(rec audit.Record) error {
+		r.add(rec)
+		return nil
+	})
+}
+
+func (r *Recorder) record(line []byte) {
+	if rec, err := audit.ParseRecord(line); err == nil {
+		r.add(rec)
+	}
+}
+
+func (r *Recorder) add(rec audit.Record) {
+	if rec.Event != "tool_call" || (r.server != "" && rec.Server != r.server) {
+		return
+	}
+	r.calls = append(r.calls, rec.ToolCallEvent)
+}
+
+// Calls returns the tool calls recorded so far.
+func (r *Recorder) Calls() []audit.ToolCallEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]audit.ToolCallEvent{}, r.calls...)
+}
+
+// Proposal is a rule suggested by Propose, with the number of observed
+// calls it covers.
+type Proposal struct {
+	Rule  config.Rule
+	Calls int
+}
+
+// minDepth is the number of leading path components that are never
+// generalized away: calls under /home/alice and /home/bob produce two
+// rules rather than one rule for /home/**.
+const minDepth = 2
+
+// Propose returns a minimal list of allow rules that covers every call.
+// Only path-like arguments (absolute paths) are constrained; each is
+// generalized to the deepest directory shared by the observed values,
+// grouped by their first two path components. Calls to a tool that never
+// passes a path get a single unconditional rule.
+func Propose(calls []audit.ToolCallEvent) []Proposal {
+	byTool := map[string][]audit.ToolCallEvent{}
+	var tools []string
+	for _, c := range calls {
+		if _, ok := byTool[c.Tool]; !ok {
+			tools = append(tools, c.Tool)
+		}
+		byTool[c.Tool] = append(byTool[c.Tool], c)
+	}
+	sort.Strings(tools)
+
+	var out []Proposal
+	for _, tool := range tools {
+		out = append(out, proposeTool(tool, byTool[tool])...)
+	}
+	return out
+}
+
+func proposeTool(tool string, calls []audit.ToolCallEvent) []Proposal {
+	key := pathArgument(calls)
+	if key == "" {
+		return []Proposal{{Rule: config.Rule{Tool: tool, Allow: true}, Calls: len(calls)}}
+	}
+
+	// Group calls by the root of their path argument, then generalize
+	// each group separately.
+	groups := map[string][]string{}
+	for _, c := range calls {
+		p := path.Clean(fmt.Sprint(c.Arguments[key]))
+		root := pathRoot(p)
+		groups[root] = append(groups[root], p)
+	}
+	roots := make([]string, 0, len(groups))
+	for root := range groups {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	var out []Proposal
+	for _, root := range roots {
+		out = append(out, Proposal{
+			Rule: config.Rule{
+				Tool:  tool,
+				Allow: true,
+				When:  map[string]string{key: generalize(root, groups[root])},
+			},
+			Calls: len(groups[root]),
+		})
+	}
+	return out
+}
+
+// pathArgument returns the name of the argument that carries an absolute
+// path in every call, preferring "path" when several do.
+func pathArgument(calls []audit.ToolCallEvent) string {
+	counts := map[string]int{}
+	for _, c := range calls {
+		for k, v := range c.Arguments {
+			if s, ok := v.(string); ok && strings.HasPrefix(s, "/") {
+				counts[k]++
+			}
+		}
+	}
+	var keys []string
+	for k, n := range counts {
+		if n == len(calls) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "path" {
+			return k
+		}
+	}
+	return keys[0]
+}
+
+// pathRoot returns the first minDepth components of a cleaned absolute path.
+func pathRoot(p string) string {
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	if len(parts) > minDepth {
+		parts = parts[:minDepth]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// generalize returns a glob covering every path, all of which are under
+// root. A single distinct path is kept exact; otherwise the deepest shared
+// directory is matched recursively, but never one above root.
+func generalize(root string, paths []string) string {
+	distinct := map[string]bool{}
+	for _, p := range paths {
+		distinct[p] = true
+	}
+	if len(distinct) == 1 {
+		return paths[0]
+	}
+
+	prefix := strings.Split(path.Dir(paths[0]), "/")
+	for _, p := range paths[1:] {
+		parts := strings.Split(path.Dir(p), "/")
+		n := 0
+		for n < len(prefix) && n < len(parts) && prefix[n] == parts[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	dir := strings.Join(prefix, "/")
+	if len(dir) < len(root) {
+		dir = root
+	}
+	return dir + "/**"
+}
+
+// WriteSnippet writes proposals as a reviewable YAML rules: block, with a
+// comment on each rule saying how many calls it covers.
+func WriteSnippet(w io.Writer, server string, proposals []Proposal) error {
+	rules := make([]config.Rule, len(proposals))
+	for i, p := range proposals {
+		rules[i] = p.Rule
+	}
+
+	var list yaml.Node
+	if err := list.Encode(rules); err != nil {
+		return err
+	}
+	for i, item := range list.Content {
+		calls := proposals[i].Calls
+		if calls == 1 {
+			item.HeadComment = "observed 1 call"
+		} else {
+			item.HeadComment = fmt.Sprintf("observed %d calls", calls)
+		}
+	}
+	doc := &yaml.Node{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "rules", HeadComment: fmt.Sprintf(
+				"Proposed rules for server %q. Review before adding them to the policy:\n"+
+					"globs are generalized from observed paths and may be broader than needed.", server)},
+			&list,
+		},
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
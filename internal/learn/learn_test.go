@@ -0,0 +1,121 @@
+package learn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+)
+
+func TestRecorderConsumesAuditLog(t *testing.T) {
+	rec := NewRecorder("fs")
+	logger := audit.New(rec)
+
+	logger.LogStartup("fs", "constellation.yaml")
+	logger.LogToolCall(audit.ToolCallEvent{Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/a"}, Decision: "deny", Rule: -1})
+	logger.LogToolCall(audit.ToolCallEvent{Server: "other", Tool: "query", Decision: "allow"})
+	logger.LogShutdown("fs")
+
+	calls := rec.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("calls = %d, want 1", len(calls))
+	}
+	if calls[0].Tool != "read_file" || calls[0].Arguments["path"] != "/a" {
+		t.Errorf("call = %+v, want read_file /a", calls[0])
+	}
+}
+
+func TestRecorderPartialWrites(t *testing.T) {
+	rec := NewRecorder("")
+	line := `{"event":"tool_call","server":"fs","tool":"ping","arguments":{}}` + "\n"
+	rec.Write([]byte(line[:10]))
+	if len(rec.Calls()) != 0 {
+		t.Fatal("incomplete line should not be recorded")
+	}
+	rec.Write([]byte(line[10:]))
+	if len(rec.Calls()) != 1 {
+		t.Fatal("expected call once the line is complete")
+	}
+}
+
+func TestPropose(t *testing.T) {
+	call := func(tool string, args map[string]any) audit.ToolCallEvent {
+		return audit.ToolCallEvent{Server: "fs", Tool: tool, Arguments: args}
+	}
+	calls := []audit.ToolCallEvent{
+		call("read_file", map[string]any{"path": "/home/alice/projects/a/main.go"}),
+		call("read_file", map[string]any{"path": "/home/alice/projects/b/lib/util.go"}),
+		call("read_file", map[string]any{"path": "/etc/hosts"}),
+		call("list_directory", map[string]any{"path": "/home/alice/projects"}),
+		call("search", map[string]any{"query": "TODO"}),
+		call("search", map[string]any{"query": "FIXME"}),
+	}
+
+	got := Propose(calls)
+	want := []config.Rule{
+		{Tool: "list_directory", Allow: true, When: map[string]string{"path": "/home/alice/projects"}},
+		{Tool: "read_file", Allow: true, When: map[string]string{"path": "/etc/hosts"}},
+		{Tool: "read_file", Allow: true, When: map[string]string{"path": "/home/alice/projects/**"}},
+		{Tool: "search", Allow: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d proposals, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		r := got[i].Rule
+		if r.Tool != w.Tool || r.Allow != w.Allow || r.When["path"] != w.When["path"] || len(r.When) != len(w.When) {
+			t.Errorf("proposal %d = %+v, want %+v", i, r, w)
+		}
+	}
+	if got[2].Calls != 2 || got[3].Calls != 2 {
+		t.Errorf("call counts = %d, %d, want 2, 2", got[2].Calls, got[3].Calls)
+	}
+}
+
+func TestProposeStaysWithinRoot(t *testing.T) {
+	calls := []audit.ToolCallEvent{
+		{Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/home/alice"}},
+		{Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/home/alice/x/y"}},
+	}
+	got := Propose(calls)
+	if len(got) != 1 || got[0].Rule.When["path"] != "/home/alice/**" {
+		t.Fatalf("proposals = %+v, want one rule for /home/alice/**", got)
+	}
+	engine := policy.NewEngine(config.Server{Default: "deny", Rules: []config.Rule{got[0].Rule}})
+	for _, c := range calls {
+		if d := engine.Evaluate(c.Tool, c.Arguments); !d.Allow {
+			t.Errorf("proposal does not cover %v", c.Arguments["path"])
+		}
+	}
+}
+
+func TestWriteSnippet(t *testing.T) {
+	proposals := []Proposal{
+		{Rule: config.Rule{Tool: "read_file", Allow: true, When: map[string]string{"path": "/srv/**"}}, Calls: 3},
+		{Rule: config.Rule{Tool: "ping", Allow: true}, Calls: 1},
+	}
+	var buf bytes.Buffer
+	if err := WriteSnippet(&buf, "fs", proposals); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "# observed 3 calls") || !strings.Contains(out, "# observed 1 call\n") {
+		t.Errorf("snippet missing call-count comments:\n%s", out)
+	}
+
+	// The snippet must parse back as policy rules.
+	var parsed struct {
+		Rules []config.Rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("snippet is not valid YAML: %v\n%s", err, out)
+	}
+	if len(parsed.Rules) != 2 || parsed.Rules[0].When["path"] != "/srv/**" {
+		t.Errorf("parsed rules = %+v", parsed.Rules)
+	}
+}
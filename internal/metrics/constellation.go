@@ -0,0 +1,42 @@
+package metrics
+
+// Default holds the proxy's metrics, served by --metrics-addr. Tool labels
+// are the tools the policy names; any other tool is counted as "other", so
+// that clients cannot grow the label set by calling made-up tools.
+var Default = NewRegistry()
+
+var (
+	latencyBuckets = ExponentialBuckets(0.0005, 2, 16) // 0.5ms to ~16s
+	sizeBuckets    = ExponentialBuckets(64, 4, 10)     // 64B to 16MiB
+
+	// ToolCalls counts tools/call requests by the decision applied.
+	ToolCalls = Default.NewCounter("constellation_tool_calls_total",
+		"Tool calls evaluated, by server, tool (other for tools the policy does not name) and decision.", "server", "tool", "decision")
+	// ToolResults counts responses to forwarded tool calls; status is ok,
+	// error (the tool reported isError) or rpc_error.
+	ToolResults = Default.NewCounter("constellation_tool_results_total",
+		"Responses to forwarded tool calls, by server, tool (other for tools the policy does not name) and status.", "server", "tool", "status")
+	// PolicyEvaluation is the time spent deciding each tool call.
+	PolicyEvaluation = Default.NewHistogram("constellation_policy_evaluation_seconds",
+		"Time to evaluate a tool call against the policy.", latencyBuckets, "server")
+	// UpstreamLatency is the time from forwarding a tool call to the
+	// server's response.
+	UpstreamLatency = Default.NewHistogram("constellation_upstream_latency_seconds",
+		"Time from forwarding a tool call to the server's response, by server and tool (other for tools the policy does not name).", latencyBuckets, "server", "tool")
+	// MessageBytes is the size of relayed JSON-RPC messages; direction is
+	// client_to_server or server_to_client.
+	MessageBytes = Default.NewHistogram("constellation_message_bytes",
+		"Size of relayed JSON-RPC messages.", sizeBuckets, "server", "direction")
+	// SecretResolutionFailures counts secret references that could not be
+	// resolved, by provider prefix.
+	SecretResolutionFailures = Default.NewCounter("constellation_secret_resolution_failures_total",
+		"Secret references that failed to resolve, by provider.", "provider")
+	// VaultRenewals counts Vault token renewal attempts; result is success
+	// or failure.
+	VaultRenewals = Default.NewCounter("constellation_vault_token_renewals_total",
+		"Vault token renewal outcomes.", "result")
+	// VaultRenewalHealthy is 1 while the Vault token is being renewed and
+	// 0 once renewal has failed or stopped.
+	VaultRenewalHealthy = Default.NewGauge("constellation_vault_token_renewal_healthy",
+		"Whether Vault token renewal is running (1) or has failed (0).")
+)
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteExposition(t *testing.T) {
+	r := NewRegistry()
+	calls := r.NewCounter("test_calls_total", "Calls made.", "tool")
+	up := r.NewGauge("test_up", "Whether it is up.")
+	latency := r.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "tool")
+
+	calls.Inc("read")
+	calls.Add(2, `say "hi"`)
+	up.Set(1)
+	latency.Observe(0.05, "read")
+	latency.Observe(0.1, "read")
+	latency.Observe(5, "read")
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_calls_total Calls made.
+# TYPE test_calls_total counter
+test_calls_total{tool="read"} 1
+test_calls_total{tool="say \"hi\""} 2
+# HELP test_up Whether it is up.
+# TYPE test_up gauge
+test_up 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{tool="read",le="0.1"} 2
+test_latency_seconds_bucket{tool="read",le="1"} 2
+test_latency_seconds_bucket{tool="read",le="+Inf"} 3
+test_latency_seconds_sum{tool="read"} 5.15
+test_latency_seconds_count{tool="read"} 3
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if n := latency.Count("read"); n != 3 {
+		t.Errorf("Count = %d, want 3", n)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Things.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "test_total 1\n") {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	c := NewRegistry().NewCounter("test_total", "Things.", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	c.Inc("only-one")
+}
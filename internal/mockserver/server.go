@@ -0,0 +1,334 @@
+package mockserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// JSON-RPC error codes the server returns.
+const (
+	codeParseError       = -32700
+	codeMethodNotFound   = -32601
+	codeInvalidParams    = -32602
+	codeInternalError    = -32603
+	codeResourceNotFound = -32002
+)
+
+// Server answers MCP requests from a Spec.
+type Server struct {
+	spec *Spec
+}
+
+// New returns a server for spec.
+func New(spec *Spec) *Server {
+	return &Server{spec: spec}
+}
+
+type request struct {
+	ID     any             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// Handle answers one JSON-RPC message. It returns nil for notifications
+// and responses, which need no reply.
+func (s *Server) Handle(data []byte) []byte {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return reply(nil, nil, &rpcError{codeParseError, "parse error"})
+	}
+	if req.ID == nil || req.Method == "" {
+		return nil
+	}
+	result, err := s.dispatch(req)
+	if err != nil {
+		rerr, ok := err.(*rpcError)
+		if !ok {
+			rerr = &rpcError{codeInternalError, err.Error()}
+		}
+		return reply(req.ID, nil, rerr)
+	}
+	return reply(req.ID, result, nil)
+}
+
+func reply(id, result any, err *rpcError) []byte {
+	resp := map[string]any{"jsonrpc": "2.0", "id": id}
+	if err != nil {
+		resp["error"] = err
+	} else {
+		resp["result"] = result
+	}
+	data, _ := json.Marshal(resp)
+	return data
+}
+
+func (s *Server) dispatch(req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		return s.initialize(), nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return s.listTools(), nil
+	case "tools/call":
+		return s.callTool(req.Params)
+	case "resources/list":
+		return s.listResources(), nil
+	case "resources/read":
+		return s.readResource(req.Params)
+	case "prompts/list":
+		return s.listPrompts(), nil
+	case "prompts/get":
+		return s.getPrompt(req.Params)
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+}
+
+func (s *Server) initialize() map[string]any {
+	caps := map[string]any{}
+	if len(s.spec.Tools) > 0 {
+		caps["tools"] = map[string]any{}
+	}
+	if len(s.spec.Resources) > 0 {
+		caps["resources"] = map[string]any{}
+	}
+	if len(s.spec.Prompts) > 0 {
+		caps["prompts"] = map[string]any{}
+	}
+	info := map[string]any{"name": s.spec.Server.Name}
+	if s.spec.Server.Version != "" {
+		info["version"] = s.spec.Server.Version
+	}
+	result := map[string]any{
+		"protocolVersion": s.spec.ProtocolVersion,
+		"capabilities":    caps,
+		"serverInfo":      info,
+	}
+	if s.spec.Instructions != "" {
+		result["instructions"] = s.spec.Instructions
+	}
+	return result
+}
+
+func (s *Server) listTools() map[string]any {
+	tools := make([]map[string]any, 0, len(s.spec.Tools))
+	for _, t := range s.spec.Tools {
+		schema := t.InputSchema
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		tool := map[string]any{"name": t.Name, "inputSchema": schema}
+		if t.Description != "" {
+			tool["description"] = t.Description
+		}
+		tools = append(tools, tool)
+	}
+	return map[string]any{"tools": tools}
+}
+
+func (s *Server) callTool(raw json.RawMessage) (any, error) {
+	var params struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &rpcError{codeInvalidParams, "invalid params: " + err.Error()}
+	}
+	for _, t := range s.spec.Tools {
+		if t.Name == params.Name {
+			return t.Response.result(params.Name, params.Arguments)
+		}
+	}
+	return nil, &rpcError{codeInvalidParams, "unknown tool: " + params.Name}
+}
+
+func (r Response) result(tool string, args map[string]any) (any, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	data := map[string]any{"Tool": tool, "Args": args}
+
+	var content any
+	switch {
+	case len(r.Content) > 0:
+		var err error
+		content = walkStrings(r.Content, func(s string) string {
+			out, rerr := render(s, data)
+			if rerr != nil && err == nil {
+				err = rerr
+			}
+			return out
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		text := r.Text
+		if text == "" {
+			text = "{{json .Args}}"
+		}
+		out, err := render(text, data)
+		if err != nil {
+			return nil, err
+		}
+		content = []any{map[string]any{"type": "text", "text": out}}
+	}
+	result := map[string]any{"content": content}
+	if r.IsError {
+		result["isError"] = true
+	}
+	return result, nil
+}
+
+func (s *Server) listResources() map[string]any {
+	resources := make([]map[string]any, 0, len(s.spec.Resources))
+	for _, r := range s.spec.Resources {
+		res := map[string]any{"uri": r.URI, "name": r.Name}
+		if r.Description != "" {
+			res["description"] = r.Description
+		}
+		if r.MimeType != "" {
+			res["mimeType"] = r.MimeType
+		}
+		resources = append(resources, res)
+	}
+	return map[string]any{"resources": resources}
+}
+
+func (s *Server) readResource(raw json.RawMessage) (any, error) {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &rpcError{codeInvalidParams, "invalid params: " + err.Error()}
+	}
+	for _, r := range s.spec.Resources {
+		if r.URI != params.URI {
+			continue
+		}
+		contents := map[string]any{"uri": r.URI}
+		if r.MimeType != "" {
+			contents["mimeType"] = r.MimeType
+		}
+		if r.Blob != "" {
+			contents["blob"] = r.Blob
+		} else {
+			contents["text"] = r.Text
+		}
+		return map[string]any{"contents": []any{contents}}, nil
+	}
+	return nil, &rpcError{codeResourceNotFound, "resource not found: " + params.URI}
+}
+
+func (s *Server) listPrompts() map[string]any {
+	prompts := make([]map[string]any, 0, len(s.spec.Prompts))
+	for _, p := range s.spec.Prompts {
+		prompt := map[string]any{"name": p.Name}
+		if p.Description != "" {
+			prompt["description"] = p.Description
+		}
+		if len(p.Arguments) > 0 {
+			args := make([]map[string]any, 0, len(p.Arguments))
+			for _, a := range p.Arguments {
+				arg := map[string]any{"name": a.Name}
+				if a.Description != "" {
+					arg["description"] = a.Description
+				}
+				if a.Required {
+					arg["required"] = true
+				}
+				args = append(args, arg)
+			}
+			prompt["arguments"] = args
+		}
+		prompts = append(prompts, prompt)
+	}
+	return map[string]any{"prompts": prompts}
+}
+
+func (s *Server) getPrompt(raw json.RawMessage) (any, error) {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &rpcError{codeInvalidParams, "invalid params: " + err.Error()}
+	}
+	for _, p := range s.spec.Prompts {
+		if p.Name != params.Name {
+			continue
+		}
+		for _, a := range p.Arguments {
+			if _, ok := params.Arguments[a.Name]; a.Required && !ok {
+				return nil, &rpcError{codeInvalidParams, fmt.Sprintf("prompt %s: missing argument %s", p.Name, a.Name)}
+			}
+		}
+		data := map[string]any{"Args": params.Arguments}
+		messages := make([]any, 0, len(p.Messages))
+		for _, m := range p.Messages {
+			text, err := render(m.Text, data)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, map[string]any{
+				"role":    m.Role,
+				"content": map[string]any{"type": "text", "text": text},
+			})
+		}
+		result := map[string]any{"messages": messages}
+		if p.Description != "" {
+			result["description"] = p.Description
+		}
+		return result, nil
+	}
+	return nil, &rpcError{codeInvalidParams, "unknown prompt: " + params.Name}
+}
+
+// ServeStdio answers newline-delimited messages read from r until EOF.
+func (s *Server) ServeStdio(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if resp := s.Handle(scanner.Bytes()); resp != nil {
+			if _, err := w.Write(append(resp, '\n')); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Handler serves the MCP streamable HTTP transport at /mcp, without
+// sessions or server-sent events: each POST carries one message and a
+// request is answered in the response body.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /mcp", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(io.LimitReader(r.Body, 16<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := s.Handle(data)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	})
+	return mux
+}
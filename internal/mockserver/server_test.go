@@ -0,0 +1,169 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSpec = `
+server: {name: files, version: 1.2.3}
+instructions: Use read_file.
+tools:
+  - name: read_file
+    input_schema: {type: object, properties: {path: {type: string}}}
+    response: {text: "contents of {{.Args.path}}"}
+  - name: delete_file
+    response: {text: "cannot delete", is_error: true}
+  - name: stat
+    response:
+      content:
+        - {type: text, text: "{{.Tool}} {{upper .Args.path}}"}
+  - name: echo
+resources:
+  - {uri: "file:///readme.md", name: readme, mime_type: text/markdown, text: "# Hello"}
+prompts:
+  - name: summarize
+    arguments: [{name: topic, required: true}]
+    messages: [{role: user, text: "Summarize {{.Args.topic}}"}]
+`
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	spec, err := ParseSpec([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(spec)
+}
+
+type response struct {
+	ID     any             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+func call(t *testing.T, s *Server, msg string) response {
+	t.Helper()
+	var resp response
+	if err := json.Unmarshal(s.Handle([]byte(msg)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestInitialize(t *testing.T) {
+	resp := call(t, newTestServer(t), `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	var result struct {
+		ProtocolVersion string         `json:"protocolVersion"`
+		Capabilities    map[string]any `json:"capabilities"`
+		ServerInfo      Info           `json:"serverInfo"`
+		Instructions    string         `json:"instructions"`
+	}
+	json.Unmarshal(resp.Result, &result)
+	if result.ServerInfo.Name != "files" || result.ProtocolVersion != DefaultProtocolVersion || result.Instructions == "" {
+		t.Errorf("initialize = %s", resp.Result)
+	}
+	for _, c := range []string{"tools", "resources", "prompts"} {
+		if _, ok := result.Capabilities[c]; !ok {
+			t.Errorf("capability %s missing", c)
+		}
+	}
+}
+
+func TestToolCalls(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		name, params, want string
+	}{
+		{"text template", `{"name":"read_file","arguments":{"path":"/a"}}`, `{"content":[{"text":"contents of /a","type":"text"}]}`},
+		{"is_error", `{"name":"delete_file","arguments":{}}`, `{"content":[{"text":"cannot delete","type":"text"}],"isError":true}`},
+		{"content template", `{"name":"stat","arguments":{"path":"/a"}}`, `{"content":[{"text":"stat /A","type":"text"}]}`},
+		{"echo", `{"name":"echo","arguments":{"x":1}}`, `{"content":[{"text":"{\"x\":1}","type":"text"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":`+tt.params+`}`)
+			if string(resp.Result) != tt.want {
+				t.Errorf("result = %s, want %s", resp.Result, tt.want)
+			}
+		})
+	}
+
+	resp := call(t, s, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"nope"}}`)
+	if resp.Error == nil || resp.Error.Code != codeInvalidParams {
+		t.Errorf("unknown tool: %+v", resp)
+	}
+}
+
+func TestResourcesAndPrompts(t *testing.T) {
+	s := newTestServer(t)
+	resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"file:///readme.md"}}`)
+	if !strings.Contains(string(resp.Result), `"text":"# Hello"`) {
+		t.Errorf("resources/read = %s", resp.Result)
+	}
+	resp = call(t, s, `{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"file:///nope"}}`)
+	if resp.Error == nil || resp.Error.Code != codeResourceNotFound {
+		t.Errorf("missing resource: %+v", resp)
+	}
+
+	resp = call(t, s, `{"jsonrpc":"2.0","id":3,"method":"prompts/get","params":{"name":"summarize","arguments":{"topic":"MCP"}}}`)
+	if !strings.Contains(string(resp.Result), `"text":"Summarize MCP"`) {
+		t.Errorf("prompts/get = %s", resp.Result)
+	}
+	resp = call(t, s, `{"jsonrpc":"2.0","id":4,"method":"prompts/get","params":{"name":"summarize"}}`)
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "missing argument topic") {
+		t.Errorf("missing prompt argument: %+v", resp)
+	}
+}
+
+func TestUnknownMethodAndNotifications(t *testing.T) {
+	s := newTestServer(t)
+	resp := call(t, s, `{"jsonrpc":"2.0","id":"a","method":"sampling/nope"}`)
+	if resp.Error == nil || resp.Error.Code != codeMethodNotFound || resp.ID != "a" {
+		t.Errorf("unknown method: %+v", resp)
+	}
+	if out := s.Handle([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); out != nil {
+		t.Errorf("notification answered: %s", out)
+	}
+}
+
+func TestServeStdio(t *testing.T) {
+	in := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}` + "\n" +
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}` + "\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}` + "\n")
+	var out bytes.Buffer
+	if err := newTestServer(t).ServeStdio(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"name":"read_file"`) {
+		t.Errorf("output = %s", out.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(newTestServer(t).Handler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/mcp", "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("request: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	resp, err = http.Post(srv.URL+"/mcp", "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("notification: %s, want 202", resp.Status)
+	}
+}
@@ -0,0 +1,225 @@
+// Package mockserver implements an MCP server whose tools, resources and
+// prompts are described in a file, for developing and testing policies
+// without the real server.
+package mockserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProtocolVersion is reported by initialize unless the spec names
+// another.
+const DefaultProtocolVersion = "2025-06-18"
+
+// Spec describes a mock server. JSON specs are read as YAML.
+type Spec struct {
+	Server          Info       `yaml:"server"`
+	ProtocolVersion string     `yaml:"protocol_version,omitempty"`
+	Instructions    string     `yaml:"instructions,omitempty"`
+	Tools           []Tool     `yaml:"tools,omitempty"`
+	Resources       []Resource `yaml:"resources,omitempty"`
+	Prompts         []Prompt   `yaml:"prompts,omitempty"`
+}
+
+// Info is the serverInfo reported by initialize.
+type Info struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// Tool is a tool and the response to calls to it.
+type Tool struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description,omitempty"`
+	InputSchema map[string]any `yaml:"input_schema,omitempty"`
+	Response    Response       `yaml:"response,omitempty"`
+}
+
+// Response is the result of a tool call. Text is a single text content
+// block; Content lists content blocks verbatim. Strings in either are
+// templates, executed with .Tool and .Args, the call's arguments. With
+// neither, the response echoes the arguments as JSON.
+type Response struct {
+	Text    string           `yaml:"text,omitempty"`
+	Content []map[string]any `yaml:"content,omitempty"`
+	IsError bool             `yaml:"is_error,omitempty"`
+}
+
+// Resource is a resource and its contents.
+type Resource struct {
+	URI         string `yaml:"uri"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	MimeType    string `yaml:"mime_type,omitempty"`
+	Text        string `yaml:"text,omitempty"`
+	// Blob is base64-encoded binary contents.
+	Blob string `yaml:"blob,omitempty"`
+}
+
+// Prompt is a prompt template.
+type Prompt struct {
+	Name        string           `yaml:"name"`
+	Description string           `yaml:"description,omitempty"`
+	Arguments   []PromptArgument `yaml:"arguments,omitempty"`
+	// Messages are templates executed with .Args, the prompt arguments.
+	Messages []PromptMessage `yaml:"messages"`
+}
+
+// PromptArgument is an argument a prompt accepts.
+type PromptArgument struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Required    bool   `yaml:"required,omitempty"`
+}
+
+// PromptMessage is one message of a prompt.
+type PromptMessage struct {
+	Role string `yaml:"role"`
+	Text string `yaml:"text"`
+}
+
+// LoadSpec reads a spec file. Unknown fields are rejected, and templates
+// are checked, so that mistakes show up before the server starts.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading mock server spec: %w", err)
+	}
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// ParseSpec parses and checks a spec.
+func ParseSpec(data []byte) (*Spec, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var s Spec
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("parsing mock server spec: %w", err)
+	}
+	if s.Server.Name == "" {
+		s.Server.Name = "constellation-mock"
+	}
+	if s.ProtocolVersion == "" {
+		s.ProtocolVersion = DefaultProtocolVersion
+	}
+
+	seen := map[string]bool{}
+	for i, t := range s.Tools {
+		if t.Name == "" {
+			return nil, fmt.Errorf("tool %d: name is required", i)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("tool %q is defined twice", t.Name)
+		}
+		seen[t.Name] = true
+		if t.Response.Text != "" && len(t.Response.Content) > 0 {
+			return nil, fmt.Errorf("tool %q: response has both text and content", t.Name)
+		}
+		if err := checkTemplates(t.Response.Text, t.Response.Content); err != nil {
+			return nil, fmt.Errorf("tool %q: %w", t.Name, err)
+		}
+	}
+	for i, r := range s.Resources {
+		if r.URI == "" || r.Name == "" {
+			return nil, fmt.Errorf("resource %d: uri and name are required", i)
+		}
+		if r.Text != "" && r.Blob != "" {
+			return nil, fmt.Errorf("resource %q: has both text and blob", r.URI)
+		}
+	}
+	for i, p := range s.Prompts {
+		if p.Name == "" {
+			return nil, fmt.Errorf("prompt %d: name is required", i)
+		}
+		for _, m := range p.Messages {
+			if m.Role != "user" && m.Role != "assistant" {
+				return nil, fmt.Errorf("prompt %q: role must be user or assistant, got %q", p.Name, m.Role)
+			}
+			if err := checkTemplates(m.Text, nil); err != nil {
+				return nil, fmt.Errorf("prompt %q: %w", p.Name, err)
+			}
+		}
+	}
+	return &s, nil
+}
+
+func checkTemplates(text string, content []map[string]any) error {
+	if _, err := parseTemplate(text); err != nil {
+		return err
+	}
+	var err error
+	walkStrings(content, func(s string) string {
+		if _, perr := parseTemplate(s); perr != nil && err == nil {
+			err = perr
+		}
+		return s
+	})
+	return err
+}
+
+var funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(funcs).Option("missingkey=zero").Parse(text)
+}
+
+// render executes text as a template.
+func render(text string, data any) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	t, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// walkStrings returns a copy of v with every string replaced by f(s).
+func walkStrings(v any, f func(string) string) any {
+	switch val := v.(type) {
+	case string:
+		return f(val)
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, e := range val {
+			out[k] = walkStrings(e, f)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, e := range val {
+			out[i] = walkStrings(e, f)
+		}
+		return out
+	case []map[string]any:
+		out := make([]any, len(val))
+		for i, e := range val {
+			out[i] = walkStrings(e, f)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,39 @@
+package mockserver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSpecDefaults(t *testing.T) {
+	spec, err := ParseSpec([]byte(`{"tools": [{"name": "read_file"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Server.Name != "constellation-mock" || spec.ProtocolVersion != DefaultProtocolVersion {
+		t.Errorf("defaults not applied: %+v", spec)
+	}
+}
+
+func TestParseSpecErrors(t *testing.T) {
+	tests := []struct {
+		name, spec, want string
+	}{
+		{"unknown field", "tools: [{name: a, respone: {text: x}}]", "respone"},
+		{"missing tool name", "tools: [{description: x}]", "name is required"},
+		{"duplicate tool", "tools: [{name: a}, {name: a}]", "defined twice"},
+		{"text and content", "tools: [{name: a, response: {text: x, content: [{type: text}]}}]", "both text and content"},
+		{"bad template", "tools: [{name: a, response: {text: '{{.Args.x'}}]", "tool \"a\""},
+		{"bad content template", "tools: [{name: a, response: {content: [{type: text, text: '{{end}}'}]}}]", "tool \"a\""},
+		{"resource without uri", "resources: [{name: a}]", "uri and name are required"},
+		{"bad role", "prompts: [{name: p, messages: [{role: system, text: x}]}]", "role must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSpec([]byte(tt.spec))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseSpec() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -16,6 +16,11 @@ func NewEngine(server config.Server) *Engine {
 	return &Engine{server: server}
 }
 
+// Server returns the server configuration the engine evaluates against.
+func (e *Engine) Server() config.Server {
+	return e.server
+}
+
 // Evaluate checks whether a tool call with the given arguments is allowed.
 // Rules are evaluated top-down; first match wins.
 func (e *Engine) Evaluate(tool string, arguments map[string]any) Decision {
@@ -24,22 +29,29 @@ func (e *Engine) Evaluate(tool string, arguments map[string]any) Decision {
 			continue
 		}
 		if e.matchWhen(rule.When, arguments) {
-			reason := fmt.Sprintf("matched rule %d", i)
-			if !rule.Allow {
-				reason = fmt.Sprintf("denied by rule %d", i)
-			}
-			return Decision{
-				Allow:       rule.Allow,
-				MatchedRule: i,
-				Reason:      reason,
-			}
+			return ruleDecision(i, rule)
 		}
 	}
 
 	// No rule matched — fall back to default
-	allow := e.server.Default == "allow"
+	return e.defaultDecision()
+}
+
+func ruleDecision(i int, rule config.Rule) Decision {
+	reason := fmt.Sprintf("matched rule %d", i)
+	if !rule.Allow {
+		reason = fmt.Sprintf("denied by rule %d", i)
+	}
 	return Decision{
-		Allow:       allow,
+		Allow:       rule.Allow,
+		MatchedRule: i,
+		Reason:      reason,
+	}
+}
+
+func (e *Engine) defaultDecision() Decision {
+	return Decision{
+		Allow:       e.server.Default == "allow",
 		MatchedRule: -1,
 		Reason:      "no matching rule, using default: " + e.server.Default,
 	}
@@ -59,19 +71,35 @@ func (e *Engine) AllowedTools() []string {
 	return tools
 }
 
+// NamesTool reports whether any rule is for tool.
+func (e *Engine) NamesTool(tool string) bool {
+	for _, rule := range e.server.Rules {
+		if rule.Tool == tool {
+			return true
+		}
+	}
+	return false
+}
+
 // matchWhen checks if all 'when' clauses match the given arguments.
 // All clauses must match (AND logic). Each clause is a glob pattern
 // matched against the string representation of the argument value.
 func (e *Engine) matchWhen(when map[string]string, arguments map[string]any) bool {
 	for key, pattern := range when {
-		val, ok := arguments[key]
-		if !ok {
-			return false
-		}
-		strVal := fmt.Sprintf("%v", val)
-		if !GlobMatch(pattern, strVal) {
+		if _, _, ok := matchClause(pattern, key, arguments); !ok {
 			return false
 		}
 	}
 	return true
 }
+
+// matchClause matches a single when clause, returning the stringified
+// argument value and whether the argument was present at all.
+func matchClause(pattern, key string, arguments map[string]any) (value string, present, matched bool) {
+	val, ok := arguments[key]
+	if !ok {
+		return "", false, false
+	}
+	strVal := fmt.Sprintf("%v", val)
+	return strVal, true, GlobMatch(pattern, strVal)
+}
@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Trace records every step Evaluate takes to reach a decision.
+type Trace struct {
+	Tool     string      `json:"tool"`
+	Rules    []RuleTrace `json:"rules"`
+	Decision Decision    `json:"-"`
+	// Fallthrough explains why no rule matched. Empty if one did.
+	Fallthrough string `json:"fallthrough,omitempty"`
+}
+
+// RuleTrace describes how one rule was evaluated.
+type RuleTrace struct {
+	Index       int    `json:"index"`
+	Tool        string `json:"tool"`
+	Allow       bool   `json:"allow"`
+	Source      string `json:"source,omitempty"`
+	ToolMatched bool   `json:"tool_matched"`
+	// Clauses is only populated when the tool name matched.
+	Clauses []ClauseTrace `json:"clauses,omitempty"`
+	Matched bool          `json:"matched"`
+}
+
+// ClauseTrace describes how one when clause was evaluated.
+type ClauseTrace struct {
+	Key     string `json:"key"`
+	Pattern string `json:"pattern"`
+	// Value is the argument as matched against the pattern; empty and
+	// Present false if the argument was missing.
+	Value   string `json:"value,omitempty"`
+	Present bool   `json:"present"`
+	Matched bool   `json:"matched"`
+}
+
+// Explain evaluates a tool call exactly as Evaluate does and records every
+// rule considered along the way. Rules after the first match are not
+// considered and do not appear in the trace. All when clauses of a rule
+// whose tool matched are evaluated, even after one fails, so the trace
+// shows every reason the rule did not apply.
+func (e *Engine) Explain(tool string, arguments map[string]any) Trace {
+	t := Trace{Tool: tool}
+	candidates := 0
+	for i, rule := range e.server.Rules {
+		rt := RuleTrace{
+			Index:       i,
+			Tool:        rule.Tool,
+			Allow:       rule.Allow,
+			Source:      rule.Source().String(),
+			ToolMatched: rule.Tool == tool,
+		}
+		if rt.ToolMatched {
+			candidates++
+			rt.Matched = true
+			for _, key := range sortedKeys(rule.When) {
+				ct := ClauseTrace{Key: key, Pattern: rule.When[key]}
+				ct.Value, ct.Present, ct.Matched = matchClause(ct.Pattern, key, arguments)
+				rt.Matched = rt.Matched && ct.Matched
+				rt.Clauses = append(rt.Clauses, ct)
+			}
+		}
+		t.Rules = append(t.Rules, rt)
+		if rt.Matched {
+			t.Decision = ruleDecision(i, rule)
+			return t
+		}
+	}
+
+	t.Decision = e.defaultDecision()
+	switch candidates {
+	case 0:
+		t.Fallthrough = fmt.Sprintf("no rule names tool %q", tool)
+	case 1:
+		t.Fallthrough = fmt.Sprintf("the only rule for tool %q did not match all of its when clauses", tool)
+	default:
+		t.Fallthrough = fmt.Sprintf("none of the %d rules for tool %q matched all of their when clauses", candidates, tool)
+	}
+	return t
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/bdubs00/constellation/internal/config"
+)
+
+func TestExplainMatchesEvaluate(t *testing.T) {
+	srv := config.Server{
+		Default: "deny",
+		Rules: []config.Rule{
+			{Tool: "write_file", Allow: false, When: map[string]string{"path": "/protected/**"}},
+			{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**", "encoding": "utf-8"}},
+			{Tool: "write_file", Allow: true},
+			{Tool: "list_directory", Allow: true},
+		},
+	}
+	engine := NewEngine(srv)
+
+	calls := []struct {
+		tool string
+		args map[string]any
+	}{
+		{"write_file", map[string]any{"path": "/protected/a"}},
+		{"write_file", map[string]any{"path": "/tmp/a"}},
+		{"read_file", map[string]any{"path": "/public/a", "encoding": "utf-8"}},
+		{"read_file", map[string]any{"path": "/public/a"}},
+		{"delete_file", map[string]any{}},
+	}
+	for _, c := range calls {
+		want := engine.Evaluate(c.tool, c.args)
+		got := engine.Explain(c.tool, c.args).Decision
+		if got != want {
+			t.Errorf("Explain(%s, %v) decision = %+v, Evaluate = %+v", c.tool, c.args, got, want)
+		}
+	}
+}
+
+func TestExplainTrace(t *testing.T) {
+	srv := config.Server{
+		Default: "deny",
+		Rules: []config.Rule{
+			{Tool: "list_directory", Allow: true},
+			{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**", "encoding": "utf-8"}},
+		},
+	}
+	trace := NewEngine(srv).Explain("read_file", map[string]any{"path": "/etc/passwd"})
+
+	if len(trace.Rules) != 2 {
+		t.Fatalf("rules traced = %d, want 2", len(trace.Rules))
+	}
+	if trace.Rules[0].ToolMatched || trace.Rules[0].Clauses != nil {
+		t.Errorf("rule 0 should be skipped on tool name: %+v", trace.Rules[0])
+	}
+
+	r := trace.Rules[1]
+	if !r.ToolMatched || r.Matched {
+		t.Errorf("rule 1 should match tool but not clauses: %+v", r)
+	}
+	if len(r.Clauses) != 2 {
+		t.Fatalf("clauses = %+v, want both evaluated", r.Clauses)
+	}
+	// Clauses are reported in key order.
+	enc, path := r.Clauses[0], r.Clauses[1]
+	if enc.Key != "encoding" || enc.Present {
+		t.Errorf("encoding clause = %+v, want missing argument", enc)
+	}
+	if path.Key != "path" || path.Value != "/etc/passwd" || path.Matched {
+		t.Errorf("path clause = %+v, want stringified non-matching value", path)
+	}
+
+	if trace.Decision.MatchedRule != -1 || trace.Fallthrough == "" {
+		t.Errorf("expected fall-through to default, got %+v", trace)
+	}
+}
+
+func TestExplainStopsAtFirstMatch(t *testing.T) {
+	srv := config.Server{
+		Default: "deny",
+		Rules: []config.Rule{
+			{Tool: "ping", Allow: true},
+			{Tool: "ping", Allow: false},
+		},
+	}
+	trace := NewEngine(srv).Explain("ping", nil)
+	if len(trace.Rules) != 1 || !trace.Rules[0].Matched {
+		t.Errorf("trace = %+v, want only the matching rule", trace.Rules)
+	}
+	if trace.Fallthrough != "" {
+		t.Errorf("fallthrough = %q, want empty when a rule matched", trace.Fallthrough)
+	}
+}
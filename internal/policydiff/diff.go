@@ -0,0 +1,296 @@
+package policydiff
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+)
+
+// Diff is the structural difference between two policies.
+type Diff struct {
+	AddedServers   []string
+	RemovedServers []string
+	// Servers lists servers present in both policies that changed.
+	Servers []ServerDiff
+}
+
+// Empty reports whether the policies are structurally identical.
+func (d *Diff) Empty() bool {
+	return len(d.AddedServers) == 0 && len(d.RemovedServers) == 0 && len(d.Servers) == 0
+}
+
+// ServerDiff describes how one server's definition changed.
+type ServerDiff struct {
+	Name string
+	// Changes describes changed scalar settings, e.g. "default: deny -> allow".
+	Changes      []string
+	AddedRules   []config.Rule
+	RemovedRules []config.Rule
+	// Reordered is set when the same rules appear in a different order,
+	// which can change first-match-wins results.
+	Reordered bool
+}
+
+// Call is a tool call to replay through both policies.
+type Call struct {
+	Server    string
+	Tool      string
+	Arguments map[string]any
+}
+
+func (c Call) key() string {
+	return fmt.Sprintf("%s\x00%s\x00%v", c.Server, c.Tool, c.Arguments)
+}
+
+// Change is a call whose decision differs between the two policies.
+type Change struct {
+	Call
+	Old, New policy.Decision
+	// OldMissing and NewMissing are set when the server does not exist in
+	// that policy; the call could not be made at all.
+	OldMissing, NewMissing bool
+}
+
+// Compare returns the structural differences from old to new.
+func Compare(old, new *config.Config) *Diff {
+	d := &Diff{}
+	for _, name := range serverNames(new) {
+		if _, ok := old.Servers[name]; !ok {
+			d.AddedServers = append(d.AddedServers, name)
+		}
+	}
+	for _, name := range serverNames(old) {
+		o := old.Servers[name]
+		n, ok := new.Servers[name]
+		if !ok {
+			d.RemovedServers = append(d.RemovedServers, name)
+			continue
+		}
+		if sd := compareServer(name, o, n); sd != nil {
+			d.Servers = append(d.Servers, *sd)
+		}
+	}
+	return d
+}
+
+func compareServer(name string, o, n config.Server) *ServerDiff {
+	sd := &ServerDiff{Name: name}
+	if o.Command != n.Command {
+		sd.Changes = append(sd.Changes, fmt.Sprintf("command: %q -> %q", o.Command, n.Command))
+	}
+	if !reflect.DeepEqual(o.Args, n.Args) {
+		sd.Changes = append(sd.Changes, fmt.Sprintf("args: %q -> %q", o.Args, n.Args))
+	}
+	if o.Default != n.Default {
+		sd.Changes = append(sd.Changes, fmt.Sprintf("default: %s -> %s", o.Default, n.Default))
+	}
+	if !reflect.DeepEqual(secretEnv(o), secretEnv(n)) {
+		sd.Changes = append(sd.Changes, "secrets.env changed")
+	}
+	if !sameSet(o.ProtocolVersions, n.ProtocolVersions) {
+		sd.Changes = append(sd.Changes, fmt.Sprintf("protocol_versions: %q -> %q", o.ProtocolVersions, n.ProtocolVersions))
+	}
+	if o.AggregatesToolList() != n.AggregatesToolList() {
+		sd.Changes = append(sd.Changes, fmt.Sprintf("aggregate_tool_list: %t -> %t", o.AggregatesToolList(), n.AggregatesToolList()))
+	}
+	sd.Changes = append(sd.Changes, compareInitialize(o.Initialize, n.Initialize)...)
+
+	sd.RemovedRules = subtract(o.Rules, n.Rules)
+	sd.AddedRules = subtract(n.Rules, o.Rules)
+	if len(sd.AddedRules) == 0 && len(sd.RemovedRules) == 0 {
+		for i := range o.Rules {
+			if !sameRule(o.Rules[i], n.Rules[i]) {
+				sd.Reordered = true
+				break
+			}
+		}
+	}
+
+	if len(sd.Changes) == 0 && len(sd.AddedRules) == 0 && len(sd.RemovedRules) == 0 && !sd.Reordered {
+		return nil
+	}
+	return sd
+}
+
+// compareInitialize describes the changes to the initialize settings.
+// Capability lists are compared as sets.
+func compareInitialize(o, n *config.InitializeConfig) []string {
+	if o == nil {
+		o = &config.InitializeConfig{}
+	}
+	if n == nil {
+		n = &config.InitializeConfig{}
+	}
+	var changes []string
+	if !sameSet(o.StripCapabilities, n.StripCapabilities) {
+		changes = append(changes, fmt.Sprintf("initialize.strip_capabilities: %q -> %q", o.StripCapabilities, n.StripCapabilities))
+	}
+	var oi, ni config.ServerInfoConfig
+	if o.ServerInfo != nil {
+		oi = *o.ServerInfo
+	}
+	if n.ServerInfo != nil {
+		ni = *n.ServerInfo
+	}
+	if oi.Name != ni.Name {
+		changes = append(changes, fmt.Sprintf("initialize.server_info.name: %q -> %q", oi.Name, ni.Name))
+	}
+	if oi.Version != ni.Version {
+		changes = append(changes, fmt.Sprintf("initialize.server_info.version: %q -> %q", oi.Version, ni.Version))
+	}
+	if a, b := instructionsMode(o.Instructions), instructionsMode(n.Instructions); a != b {
+		changes = append(changes, fmt.Sprintf("initialize.instructions: %s -> %s", a, b))
+	}
+	return changes
+}
+
+// instructionsMode summarises how in rewrites the server's instructions.
+func instructionsMode(in *config.InstructionsConfig) string {
+	switch {
+	case in == nil:
+		return "passed through"
+	case in.Strip:
+		return "stripped"
+	case in.Replace != "":
+		return fmt.Sprintf("replaced with %q", in.Replace)
+	default:
+		return fmt.Sprintf("remove %q", in.Remove)
+	}
+}
+
+func sameSet(a, b []string) bool {
+	a, b = slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b))
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// Replay evaluates every call against both policies and returns the calls
+// whose decision differs, including calls to servers that exist in only
+// one of them. Duplicate calls are replayed once; replayed is the number
+// of distinct calls.
+func Replay(old, new *config.Config, calls []Call) (changes []Change, replayed int) {
+	oldEngines, newEngines := engines(old), engines(new)
+	seen := map[string]bool{}
+	for _, c := range calls {
+		if seen[c.key()] {
+			continue
+		}
+		seen[c.key()] = true
+
+		oe, oOK := oldEngines[c.Server]
+		ne, nOK := newEngines[c.Server]
+		ch := Change{Call: c, OldMissing: !oOK, NewMissing: !nOK}
+		if oOK {
+			ch.Old = oe.Evaluate(c.Tool, c.Arguments)
+		}
+		if nOK {
+			ch.New = ne.Evaluate(c.Tool, c.Arguments)
+		}
+		if ch.OldMissing != ch.NewMissing || ch.Old.Allow != ch.New.Allow {
+			changes = append(changes, ch)
+		}
+	}
+	return changes, len(seen)
+}
+
+// SampleCalls synthesizes calls that exercise every rule in the given
+// policies: one per rule, with arguments built to match its when
+// patterns, plus one call per tool with no arguments to probe the
+// defaults. Alternations and character classes are resolved to their
+// first option; negated classes are left as-is and will not match.
+func SampleCalls(cfgs ...*config.Config) []Call {
+	var calls []Call
+	for _, cfg := range cfgs {
+		for _, name := range serverNames(cfg) {
+			tools := map[string]bool{}
+			for _, rule := range cfg.Servers[name].Rules {
+				args := make(map[string]any, len(rule.When))
+				for key, pattern := range rule.When {
+					args[key] = sampleValue(pattern)
+				}
+				calls = append(calls, Call{Server: name, Tool: rule.Tool, Arguments: args})
+				if !tools[rule.Tool] {
+					tools[rule.Tool] = true
+					calls = append(calls, Call{Server: name, Tool: rule.Tool, Arguments: map[string]any{}})
+				}
+			}
+		}
+	}
+	return calls
+}
+
+var (
+	alternation = regexp.MustCompile(`\{([^,}]*)[^}]*\}`)
+	charClass   = regexp.MustCompile(`\[([^!^\]])[^\]]*\]`)
+)
+
+// sampleValue turns a glob into a concrete string the glob matches.
+func sampleValue(pattern string) string {
+	s := alternation.ReplaceAllString(pattern, "$1")
+	s = charClass.ReplaceAllString(s, "$1")
+	s = strings.ReplaceAll(s, "**", "sample/path")
+	s = strings.ReplaceAll(s, "*", "sample")
+	s = strings.ReplaceAll(s, "?", "x")
+	return s
+}
+
+func engines(cfg *config.Config) map[string]*policy.Engine {
+	m := make(map[string]*policy.Engine, len(cfg.Servers))
+	for name, srv := range cfg.Servers {
+		m[name] = policy.NewEngine(srv)
+	}
+	return m
+}
+
+func serverNames(cfg *config.Config) []string {
+	names := make([]string, 0, len(cfg.Servers))
+	for name := range cfg.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func secretEnv(s config.Server) map[string]string {
+	if s.Secrets == nil {
+		return nil
+	}
+	return s.Secrets.Env
+}
+
+func sameRule(a, b config.Rule) bool {
+	if a.Tool != b.Tool || a.Allow != b.Allow || len(a.When) != len(b.When) {
+		return false
+	}
+	for k, v := range a.When {
+		if w, ok := b.When[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// subtract returns the rules in a that have no counterpart in b, treating
+// both as multisets.
+func subtract(a, b []config.Rule) []config.Rule {
+	used := make([]bool, len(b))
+	var out []config.Rule
+	for _, r := range a {
+		found := false
+		for j, other := range b {
+			if !used[j] && sameRule(r, other) {
+				used[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			out = append(out, r)
+		}
+	}
+	return out
+}
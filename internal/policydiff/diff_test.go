@@ -0,0 +1,163 @@
+package policydiff
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+)
+
+func TestCompare(t *testing.T) {
+	old := &config.Config{Servers: map[string]config.Server{
+		"fs": {Command: "fs", Default: "deny", Rules: []config.Rule{
+			{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**"}},
+			{Tool: "list_directory", Allow: true},
+		}},
+		"db":   {Command: "db", Default: "deny"},
+		"same": {Command: "s", Default: "deny", Rules: []config.Rule{{Tool: "a", Allow: true}, {Tool: "b", Allow: true}}},
+	}}
+	new := &config.Config{Servers: map[string]config.Server{
+		"fs": {Command: "fs", Default: "allow", Rules: []config.Rule{
+			{Tool: "read_file", Allow: true, When: map[string]string{"path": "/**"}},
+			{Tool: "list_directory", Allow: true},
+		}},
+		"web":  {Command: "web", Default: "deny"},
+		"same": {Command: "s", Default: "deny", Rules: []config.Rule{{Tool: "b", Allow: true}, {Tool: "a", Allow: true}}},
+	}}
+
+	d := Compare(old, new)
+	if len(d.AddedServers) != 1 || d.AddedServers[0] != "web" {
+		t.Errorf("added = %v, want [web]", d.AddedServers)
+	}
+	if len(d.RemovedServers) != 1 || d.RemovedServers[0] != "db" {
+		t.Errorf("removed = %v, want [db]", d.RemovedServers)
+	}
+	if len(d.Servers) != 2 {
+		t.Fatalf("changed servers = %+v, want fs and same", d.Servers)
+	}
+	fs, same := d.Servers[0], d.Servers[1]
+	if fs.Name != "fs" || len(fs.Changes) != 1 || len(fs.AddedRules) != 1 || len(fs.RemovedRules) != 1 {
+		t.Errorf("fs diff = %+v", fs)
+	}
+	if fs.AddedRules[0].When["path"] != "/**" || fs.RemovedRules[0].When["path"] != "/public/**" {
+		t.Errorf("fs rule diff = %+v", fs)
+	}
+	if same.Name != "same" || !same.Reordered || len(same.AddedRules) != 0 {
+		t.Errorf("same diff = %+v, want reordered only", same)
+	}
+}
+
+func TestCompareServerSettings(t *testing.T) {
+	base := config.Server{
+		Command:          "fs",
+		Default:          "deny",
+		ProtocolVersions: []string{"2025-03-26", "2025-06-18"},
+		Initialize: &config.InitializeConfig{
+			StripCapabilities: []string{"prompts", "resources"},
+			ServerInfo:        &config.ServerInfoConfig{Name: "filesystem"},
+			Instructions:      &config.InstructionsConfig{Strip: true},
+		},
+	}
+	tests := []struct {
+		name   string
+		change func(*config.Server)
+		want   string
+	}{
+		{"re-enable capability", func(s *config.Server) {
+			s.Initialize.StripCapabilities = []string{"resources"}
+		}, `initialize.strip_capabilities: ["prompts" "resources"] -> ["resources"]`},
+		{"drop initialize", func(s *config.Server) {
+			s.Initialize = nil
+		}, `initialize.strip_capabilities: ["prompts" "resources"] -> []`},
+		{"server info", func(s *config.Server) {
+			s.Initialize.ServerInfo = &config.ServerInfoConfig{Name: "fs", Version: "1.0"}
+		}, `initialize.server_info.name: "filesystem" -> "fs"`},
+		{"instructions", func(s *config.Server) {
+			s.Initialize.Instructions = &config.InstructionsConfig{Replace: "Be careful."}
+		}, `initialize.instructions: stripped -> replaced with "Be careful."`},
+		{"protocol versions", func(s *config.Server) {
+			s.ProtocolVersions = []string{"2025-06-18"}
+		}, `protocol_versions: ["2025-03-26" "2025-06-18"] -> ["2025-06-18"]`},
+		{"aggregate tool list", func(s *config.Server) {
+			aggregate := true
+			s.AggregateToolList = &aggregate
+		}, `aggregate_tool_list: false -> true`},
+	}
+	for _, tt := range tests {
+		n := base
+		init := *base.Initialize
+		n.Initialize = &init
+		tt.change(&n)
+		d := Compare(
+			&config.Config{Servers: map[string]config.Server{"fs": base}},
+			&config.Config{Servers: map[string]config.Server{"fs": n}})
+		if len(d.Servers) != 1 || !slices.Contains(d.Servers[0].Changes, tt.want) {
+			t.Errorf("%s: diff = %+v, want change %s", tt.name, d.Servers, tt.want)
+		}
+	}
+
+	// The same versions in another order are not a change.
+	n := base
+	n.ProtocolVersions = []string{"2025-06-18", "2025-03-26"}
+	d := Compare(
+		&config.Config{Servers: map[string]config.Server{"fs": base}},
+		&config.Config{Servers: map[string]config.Server{"fs": n}})
+	if !d.Empty() {
+		t.Errorf("reordered protocol_versions: diff = %+v", d.Servers)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	old := &config.Config{Servers: map[string]config.Server{
+		"fs": {Default: "deny", Rules: []config.Rule{
+			{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**"}},
+		}},
+	}}
+	new := &config.Config{Servers: map[string]config.Server{
+		"fs": {Default: "deny", Rules: []config.Rule{
+			{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**"}},
+			{Tool: "read_file", Allow: true, When: map[string]string{"path": "/home/**"}},
+		}},
+	}}
+	calls := []Call{
+		{Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/public/a"}},
+		{Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/home/a"}},
+		{Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/home/a"}},
+		{Server: "db", Tool: "query", Arguments: map[string]any{}},
+	}
+	changes, replayed := Replay(old, new, calls)
+	if replayed != 3 {
+		t.Errorf("replayed = %d, want 3 distinct calls", replayed)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("changes = %+v, want 1", changes)
+	}
+	c := changes[0]
+	if c.Arguments["path"] != "/home/a" || c.Old.Allow || !c.New.Allow || c.New.MatchedRule != 1 {
+		t.Errorf("change = %+v", c)
+	}
+}
+
+func TestSampleCallsMatchTheirRules(t *testing.T) {
+	rules := []config.Rule{
+		{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**"}},
+		{Tool: "write_file", Allow: true, When: map[string]string{"path": "/tmp/*.{log,txt}"}},
+		{Tool: "query", Allow: true, When: map[string]string{"db": "prod_[abc]?"}},
+	}
+	cfg := &config.Config{Servers: map[string]config.Server{"s": {Default: "deny", Rules: rules}}}
+	engine := policy.NewEngine(cfg.Servers["s"])
+
+	calls := SampleCalls(cfg)
+	if len(calls) != 6 {
+		t.Fatalf("calls = %d, want a rule probe and a default probe per tool", len(calls))
+	}
+	for _, c := range calls {
+		if len(c.Arguments) == 0 {
+			continue
+		}
+		if d := engine.Evaluate(c.Tool, c.Arguments); !d.Allow {
+			t.Errorf("sample %s %v does not match its rule", c.Tool, c.Arguments)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package policytest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+)
+
+// Suite is a file of declarative policy test cases.
+type Suite struct {
+	// Policy is the policy file under test, relative to the suite file.
+	// When empty the caller supplies one.
+	Policy string `yaml:"policy,omitempty"`
+	Tests  []Case `yaml:"tests"`
+
+	// Path is the file the suite was loaded from.
+	Path string `yaml:"-"`
+}
+
+// Case is a single tool call and the decision the policy should make.
+type Case struct {
+	Name      string         `yaml:"name"`
+	Server    string         `yaml:"server"`
+	Tool      string         `yaml:"tool"`
+	Arguments map[string]any `yaml:"arguments,omitempty"`
+	Expect    string         `yaml:"expect"`
+	// Rule optionally pins the index of the rule that should decide the
+	// call; -1 means the server default.
+	Rule *int `yaml:"rule,omitempty"`
+}
+
+// Result is the outcome of running one Case.
+type Result struct {
+	Case     Case
+	Decision policy.Decision
+	// Rule is the rule that decided the call, or nil if the default applied.
+	Rule *config.Rule
+	// Err is set when the case could not be evaluated at all, e.g. because
+	// it names a server that is not in the policy.
+	Err error
+}
+
+// Passed reports whether the policy made the expected decision.
+func (r Result) Passed() bool {
+	if r.Err != nil {
+		return false
+	}
+	if r.Decision.Allow != (r.Case.Expect == "allow") {
+		return false
+	}
+	return r.Case.Rule == nil || *r.Case.Rule == r.Decision.MatchedRule
+}
+
+// LoadSuite reads a test suite file. Unknown fields are rejected so that a
+// misspelled expectation cannot silently pass.
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading test suite: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var s Suite
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("parsing test suite %s: %w", path, err)
+	}
+	s.Path = path
+
+	for i, tc := range s.Tests {
+		if tc.Server == "" || tc.Tool == "" {
+			return nil, fmt.Errorf("%s: test %d: server and tool are required", path, i)
+		}
+		if tc.Expect != "allow" && tc.Expect != "deny" {
+			return nil, fmt.Errorf("%s: test %d: expect must be \"allow\" or \"deny\", got %q", path, i, tc.Expect)
+		}
+		if tc.Name == "" {
+			s.Tests[i].Name = fmt.Sprintf("%s/%s #%d", tc.Server, tc.Tool, i)
+		}
+	}
+	return &s, nil
+}
+
+// PolicyPath returns the policy file the suite targets, resolved relative
+// to the suite file, or fallback if the suite does not name one.
+func (s *Suite) PolicyPath(fallback string) string {
+	if s.Policy == "" {
+		return fallback
+	}
+	if filepath.IsAbs(s.Policy) {
+		return s.Policy
+	}
+	return filepath.Join(filepath.Dir(s.Path), s.Policy)
+}
+
+// Run evaluates each case against cfg using the same engine the proxy uses.
+func Run(cfg *config.Config, cases []Case) []Result {
+	engines := map[string]*policy.Engine{}
+	results := make([]Result, 0, len(cases))
+	for _, tc := range cases {
+		srv, ok := cfg.Servers[tc.Server]
+		if !ok {
+			results = append(results, Result{Case: tc, Err: fmt.Errorf("server %q not found in policy", tc.Server)})
+			continue
+		}
+		engine, ok := engines[tc.Server]
+		if !ok {
+			engine = policy.NewEngine(srv)
+			engines[tc.Server] = engine
+		}
+
+		args := tc.Arguments
+		if args == nil {
+			args = map[string]any{}
+		}
+		d := engine.Evaluate(tc.Tool, args)
+		r := Result{Case: tc, Decision: d}
+		if d.MatchedRule >= 0 {
+			r.Rule = &srv.Rules[d.MatchedRule]
+		}
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,97 @@
+package policytest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bdubs00/constellation/internal/config"
+)
+
+func TestRun(t *testing.T) {
+	cfg := &config.Config{
+		Servers: map[string]config.Server{
+			"fs": {
+				Default: "deny",
+				Rules: []config.Rule{
+					{Tool: "read_file", Allow: true, When: map[string]string{"path": "/public/**"}},
+				},
+			},
+		},
+	}
+	zero, dflt := 0, -1
+	cases := []Case{
+		{Name: "public read", Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/public/a"}, Expect: "allow", Rule: &zero},
+		{Name: "private read", Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/etc/passwd"}, Expect: "deny", Rule: &dflt},
+		{Name: "wrong expectation", Server: "fs", Tool: "write_file", Expect: "allow"},
+		{Name: "wrong rule", Server: "fs", Tool: "read_file", Arguments: map[string]any{"path": "/public/a"}, Expect: "allow", Rule: &dflt},
+		{Name: "unknown server", Server: "db", Tool: "query", Expect: "deny"},
+	}
+
+	results := Run(cfg, cases)
+	want := []bool{true, true, false, false, false}
+	for i, r := range results {
+		if r.Passed() != want[i] {
+			t.Errorf("%s: passed = %v, want %v (decision %+v, err %v)", r.Case.Name, r.Passed(), want[i], r.Decision, r.Err)
+		}
+	}
+	if results[0].Rule == nil || results[0].Rule.Tool != "read_file" {
+		t.Errorf("expected matched rule to be reported, got %+v", results[0].Rule)
+	}
+	if results[1].Rule != nil {
+		t.Errorf("default decision should not report a rule, got %+v", results[1].Rule)
+	}
+	if results[4].Err == nil {
+		t.Error("expected error for unknown server")
+	}
+}
+
+func TestLoadSuite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fs_test.yaml")
+	content := `
+policy: ../constellation.yaml
+tests:
+  - server: fs
+    tool: read_file
+    arguments: {path: /public/a}
+    expect: allow
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSuite(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.Tests) != 1 || s.Tests[0].Name != "fs/read_file #0" {
+		t.Errorf("tests = %+v, want one test with a generated name", s.Tests)
+	}
+	if got, want := s.PolicyPath("default.yaml"), filepath.Join(dir, "..", "constellation.yaml"); got != want {
+		t.Errorf("PolicyPath = %q, want %q", got, want)
+	}
+}
+
+func TestLoadSuiteRejectsTypos(t *testing.T) {
+	tests := map[string]string{
+		"unknown field": "tests:\n  - server: fs\n    tool: t\n    expcet: allow\n",
+		"bad expect":    "tests:\n  - server: fs\n    tool: t\n    expect: maybe\n",
+		"missing tool":  "tests:\n  - server: fs\n    expect: allow\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "x_test.yaml")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadSuite(path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), path) {
+				t.Errorf("error %v should name the suite file", err)
+			}
+		})
+	}
+}
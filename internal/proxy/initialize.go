@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/recording"
+)
+
+// capabilityMethods maps each strippable capability to the prefixes of
+// the request and notification methods that belong to it.
+var capabilityMethods = map[string][]string{
+	"resources":   {"resources/", "notifications/resources/"},
+	"prompts":     {"prompts/", "notifications/prompts/"},
+	"logging":     {"logging/", "notifications/message"},
+	"completions": {"completion/"},
+}
+
+// strippedCapability returns the stripped capability method belongs to,
+// or "" if it is not blocked.
+func (p *Proxy) strippedCapability(method string) string {
+	init := p.currentEngine().Server().Initialize
+	if init == nil {
+		return ""
+	}
+	for _, c := range init.StripCapabilities {
+		for _, prefix := range capabilityMethods[c] {
+			if strings.HasPrefix(method, prefix) {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+// RewriteInitializeResponse applies init to the result of an initialize
+// response: stripped capabilities are removed, serverInfo fields are
+// replaced and instructions are dropped, replaced or filtered. Fields it
+// does not touch are passed through unchanged.
+func RewriteInitializeResponse(raw json.RawMessage, init *config.InitializeConfig) ([]byte, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, err
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(envelope["result"], &result); err != nil {
+		return nil, err
+	}
+
+	if len(init.StripCapabilities) > 0 && result["capabilities"] != nil {
+		var caps map[string]json.RawMessage
+		if err := json.Unmarshal(result["capabilities"], &caps); err != nil {
+			return nil, err
+		}
+		for name := range caps {
+			if slices.Contains(init.StripCapabilities, name) {
+				delete(caps, name)
+			}
+		}
+		if err := setField(result, "capabilities", caps); err != nil {
+			return nil, err
+		}
+	}
+
+	if si := init.ServerInfo; si != nil {
+		info := map[string]json.RawMessage{}
+		if result["serverInfo"] != nil {
+			if err := json.Unmarshal(result["serverInfo"], &info); err != nil {
+				return nil, err
+			}
+		}
+		for key, value := range map[string]string{"name": si.Name, "version": si.Version} {
+			if value != "" {
+				if err := setField(info, key, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := setField(result, "serverInfo", info); err != nil {
+			return nil, err
+		}
+	}
+
+	if in := init.Instructions; in != nil {
+		var text string
+		if result["instructions"] != nil {
+			json.Unmarshal(result["instructions"], &text)
+		}
+		switch {
+		case in.Strip:
+			text = ""
+		case in.Replace != "":
+			text = in.Replace
+		default:
+			for _, pattern := range in.Remove {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, err
+				}
+				text = re.ReplaceAllString(text, "")
+			}
+			text = strings.TrimSpace(text)
+		}
+		delete(result, "instructions")
+		if text != "" {
+			if err := setField(result, "instructions", text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := setField(envelope, "result", result); err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
+// rewriteInitialize applies the policy's initialize settings to the
+// server's initialize response. A response that cannot be rewritten is
+// answered with an error in its place, so the client never sees the
+// capabilities or instructions the policy removes.
+func (p *Proxy) rewriteInitialize(msg *Message) *Message {
+	init := p.currentEngine().Server().Initialize
+	if init == nil {
+		return msg
+	}
+	rewritten, err := RewriteInitializeResponse(msg.Raw, init)
+	if err == nil {
+		if m, err := ParseMessage(rewritten); err == nil {
+			return m
+		}
+	}
+	log.Printf("WARNING: rewriting initialize response: %v", err)
+	refused, _ := ParseMessage(BuildErrorResponse(msg.ID, -32603, "initialize response could not be filtered by policy"))
+	return refused
+}
+
+func setField(m map[string]json.RawMessage, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m[key] = data
+	return nil
+}
+
+// refuseCapability answers a request for a stripped capability with
+// "method not found", since the client was never offered it.
+// Notifications are dropped.
+func (p *Proxy) refuseCapability(msg *Message, capability string) {
+	if msg.ID == nil {
+		return
+	}
+	errResp := BuildErrorResponse(msg.ID, -32601, "method not found: capability "+capability+" is disabled by policy")
+	p.recorder.Record(recording.ProxyToClient, errResp, "")
+	p.respond(errResp)
+}
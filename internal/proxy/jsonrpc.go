@@ -56,6 +56,66 @@ func (m *Message) AsToolCall() (*ToolCall, error) {
 	return &tc, nil
 }
 
+// Meta returns the request's params._meta object, or nil if it has none.
+func (m *Message) Meta() map[string]any {
+	var params struct {
+		Meta map[string]any `json:"_meta"`
+	}
+	if len(m.Params) == 0 || json.Unmarshal(m.Params, &params) != nil {
+		return nil
+	}
+	return params.Meta
+}
+
+// SetMeta sets key in a request's params._meta, creating the object if
+// needed. Returns the modified JSON; other values are passed through
+// undecoded, so large numbers keep their precision.
+func SetMeta(raw json.RawMessage, key string, value any) ([]byte, error) {
+	var msg struct {
+		Params struct {
+			Meta map[string]json.RawMessage `json:"_meta"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	meta := msg.Params.Meta
+	if meta == nil {
+		meta = map[string]json.RawMessage{}
+	}
+	var err error
+	if meta[key], err = json.Marshal(value); err != nil {
+		return nil, err
+	}
+	return setParam(raw, "_meta", meta)
+}
+
+// setParam sets key in a request's params, creating them if needed.
+// Returns the modified JSON.
+func setParam(raw json.RawMessage, key string, value any) ([]byte, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, err
+	}
+	var params map[string]json.RawMessage
+	if p, ok := envelope["params"]; ok {
+		if err := json.Unmarshal(p, &params); err != nil {
+			return nil, err
+		}
+	}
+	if params == nil {
+		params = map[string]json.RawMessage{}
+	}
+	var err error
+	if params[key], err = json.Marshal(value); err != nil {
+		return nil, err
+	}
+	if envelope["params"], err = json.Marshal(params); err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
 // AsToolList extracts the tool list from a tools/list response.
 func (m *Message) AsToolList() ([]ToolInfo, error) {
 	if m.Result == nil {
@@ -91,7 +151,7 @@ func FilterToolListResponse(raw json.RawMessage, allowed []string) ([]byte, erro
 		return nil, err
 	}
 
-	var filtered []json.RawMessage
+	filtered := []json.RawMessage{}
 	for _, toolRaw := range result.Tools {
 		var info struct {
 			Name string `json:"name"`
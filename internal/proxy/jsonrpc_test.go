@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -107,3 +108,37 @@ func TestBuildErrorResponse(t *testing.T) {
 		t.Errorf("error code = %d, want -32600", msg.Error.Code)
 	}
 }
+
+func TestSetParamAndMeta(t *testing.T) {
+	tests := []struct {
+		raw  string
+		set  func(json.RawMessage) ([]byte, error)
+		want string
+	}{
+		{`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2099-01-01"}}`,
+			func(raw json.RawMessage) ([]byte, error) { return setParam(raw, "protocolVersion", "2025-06-18") },
+			`{"id":0,"jsonrpc":"2.0","method":"initialize","params":{"protocolVersion":"2025-06-18"}}`},
+		{`{"jsonrpc":"2.0","id":1,"method":"ping","params":null}`,
+			func(raw json.RawMessage) ([]byte, error) { return setParam(raw, "x", 1) },
+			`{"id":1,"jsonrpc":"2.0","method":"ping","params":{"x":1}}`},
+		{`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"t","_meta":{"progressToken":5}}}`,
+			func(raw json.RawMessage) ([]byte, error) { return SetMeta(raw, "traceparent", "00-abc") },
+			`{"id":2,"jsonrpc":"2.0","method":"tools/call","params":{"_meta":{"progressToken":5,"traceparent":"00-abc"},"name":"t"}}`},
+		{`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"arguments":{"n":12345678901234567890},"_meta":{"progressToken":9007199254740993}}}`,
+			func(raw json.RawMessage) ([]byte, error) { return SetMeta(raw, "traceparent", "00-abc") },
+			`{"id":4,"jsonrpc":"2.0","method":"tools/call","params":{"_meta":{"progressToken":9007199254740993,"traceparent":"00-abc"},"arguments":{"n":12345678901234567890}}}`},
+		{`{"jsonrpc":"2.0","id":3,"method":"tools/call"}`,
+			func(raw json.RawMessage) ([]byte, error) { return SetMeta(raw, "traceparent", "00-abc") },
+			`{"id":3,"jsonrpc":"2.0","method":"tools/call","params":{"_meta":{"traceparent":"00-abc"}}}`},
+	}
+	for _, tt := range tests {
+		got, err := tt.set(json.RawMessage(tt.raw))
+		if err != nil {
+			t.Errorf("%s: %v", tt.raw, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.raw, got, tt.want)
+		}
+	}
+}
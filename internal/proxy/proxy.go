@@ -2,22 +2,32 @@ package proxy
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/bdubs00/constellation/internal/audit"
 	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/metrics"
 	"github.com/bdubs00/constellation/internal/policy"
+	"github.com/bdubs00/constellation/internal/recording"
+	"github.com/bdubs00/constellation/internal/tracing"
 )
 
 // Proxy brokers JSON-RPC messages between an MCP client and server,
 // evaluating tool calls against a policy engine.
 type Proxy struct {
+	// engine is replaced by SetEngine when the policy is reloaded.
+	engineMu     sync.RWMutex
 	engine       *policy.Engine
+	loadedAt     time.Time
 	logger       *audit.Logger
 	serverName   string
 	dryRun       bool
@@ -25,13 +35,105 @@ type Proxy struct {
 	serverStdout io.Reader
 	clientReader io.Reader
 	clientWriter io.Writer
+
+	// exposedTools accumulates tool names across tools/list pages so the
+	// policy can be checked against the server's full catalogue once.
+	exposedTools []string
+	toolsChecked bool
+	// catalogue caches the aggregated tool list; see toollist.go.
+	catalogue toolCatalogue
+
+	// forwardMu serializes writes to the server, and respondMu writes to
+	// the client; both relay goroutines make each.
+	forwardMu sync.Mutex
+	respondMu sync.Mutex
+
+	// stop is closed by Stop; stopChild terminates the server process.
+	stop      chan struct{}
+	stopOnce  sync.Once
+	stopMu    sync.Mutex
+	stopChild func()
+
+	// sessionID is stamped on audit records; calls numbers tool calls for
+	// their correlation IDs.
+	sessionID string
+	calls     atomic.Uint64
+
+	// pending holds forwarded tools/call requests by JSON-RPC id until
+	// their responses are audited.
+	pendingMu sync.Mutex
+	pending   map[string]pendingCall
+
+	// tracer records spans under the session span; both may be nil.
+	tracer  *tracing.Tracer
+	session *tracing.Span
+
+	// recorder captures every message relayed; it may be nil.
+	recorder *recording.Recorder
+
+	// State reported by the admin API; see status.go.
+	startedAt   time.Time
+	childUp     atomic.Bool
+	initialized atomic.Bool
+	// rejected is set once the server negotiates a protocol version the
+	// policy does not allow; nothing is forwarded after that.
+	rejected  atomic.Bool
+	draining  atomic.Bool
+	statusMu  sync.Mutex
+	client    SessionInfo
+	decisions []DecisionInfo
+}
+
+// New returns a proxy for serverName that reads the client from stdin and
+// writes to stdout. tracer may be nil to disable tracing. Call Serve to
+// start it.
+func New(serverName string, engine *policy.Engine, logger *audit.Logger, tracer *tracing.Tracer, dryRun bool) *Proxy {
+	return &Proxy{
+		engine:       engine,
+		loadedAt:     time.Now(),
+		logger:       logger,
+		serverName:   serverName,
+		sessionID:    newSessionID(),
+		dryRun:       dryRun,
+		clientReader: os.Stdin,
+		clientWriter: os.Stdout,
+		tracer:       tracer,
+		stop:         make(chan struct{}),
+	}
+}
+
+// SetClient replaces the client's stdin and stdout.
+func (p *Proxy) SetClient(r io.Reader, w io.Writer) {
+	p.clientReader, p.clientWriter = r, w
+}
+
+// SetRecorder records the session's messages to rec.
+func (p *Proxy) SetRecorder(rec *recording.Recorder) {
+	p.recorder = rec
 }
 
 // Run starts the proxy. It spawns the MCP server as a child process and
 // brokers messages between the client (our stdin/stdout) and the server.
-func Run(serverName string, srv config.Server, engine *policy.Engine, logger *audit.Logger, dryRun bool, extraEnv map[string]string) error {
+// tracer may be nil to disable tracing.
+func Run(serverName string, srv config.Server, engine *policy.Engine, logger *audit.Logger, tracer *tracing.Tracer, dryRun bool, extraEnv map[string]string) error {
+	return New(serverName, engine, logger, tracer, dryRun).Serve(srv, extraEnv)
+}
+
+// Serve spawns the MCP server described by srv, with extraEnv added to its
+// environment, and brokers messages until the client disconnects.
+func (p *Proxy) Serve(srv config.Server, extraEnv map[string]string) error {
+	serverName, logger := p.serverName, p.logger
+	p.startedAt = time.Now()
+	logger.SetSession(p.sessionID)
 	logger.LogStartup(serverName, "")
 
+	// The session joins the trace the proxy was started in, if any.
+	parent, _ := tracing.ParseTraceparent(os.Getenv("TRACEPARENT"))
+	session := p.tracer.Start("mcp.session", parent, tracing.KindInternal,
+		tracing.String("constellation.server", serverName),
+		tracing.String("constellation.session_id", p.sessionID))
+	p.session = session
+
 	cmd := exec.Command(srv.Command, srv.Args...)
 	cmd.Stderr = os.Stderr
 
@@ -40,6 +142,9 @@ func Run(serverName string, srv config.Server, engine *policy.Engine, logger *au
 	for k, v := range extraEnv {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
+	if session != nil {
+		cmd.Env = append(cmd.Env, "TRACEPARENT="+session.Context().Traceparent())
+	}
 
 	serverIn, err := cmd.StdinPipe()
 	if err != nil {
@@ -51,28 +156,69 @@ func Run(serverName string, srv config.Server, engine *policy.Engine, logger *au
 	}
 
 	if err := cmd.Start(); err != nil {
+		session.SetError(err.Error())
+		session.End()
 		return fmt.Errorf("starting server %q: %w", srv.Command, err)
 	}
+	p.childUp.Store(true)
+	p.stopMu.Lock()
+	p.stopChild = func() { cmd.Process.Signal(syscall.SIGTERM) }
+	p.stopMu.Unlock()
+	p.ServeConn(serverIn, serverOut)
 
-	p := &Proxy{
-		engine:       engine,
-		logger:       logger,
-		serverName:   serverName,
-		dryRun:       dryRun,
-		serverStdin:  serverIn,
-		serverStdout: serverOut,
-		clientReader: os.Stdin,
-		clientWriter: os.Stdout,
+	session.End()
+	logger.LogShutdown(serverName)
+	err = cmd.Wait()
+	p.childUp.Store(false)
+	if p.rejected.Load() {
+		// The server was stopped for its protocol version; that is the
+		// session's outcome, not how the process exited.
+		return fmt.Errorf("server %q negotiated a protocol version the policy does not allow", serverName)
 	}
+	return err
+}
+
+// ServeConn brokers messages with a server that is already running until
+// the client disconnects, then closes serverIn and waits for the server
+// to finish writing.
+func (p *Proxy) ServeConn(serverIn io.WriteCloser, serverOut io.Reader) {
+	p.serverStdin, p.serverStdout = serverIn, serverOut
 
 	// Proxy server responses back to client
-	go p.relayServerToClient()
+	done := make(chan struct{})
+	go func() {
+		p.relayServerToClient()
+		close(done)
+	}()
 
 	// Read client messages and evaluate them
-	p.relayClientToServer()
+	clientDone := make(chan struct{})
+	go func() {
+		p.relayClientToServer()
+		close(clientDone)
+	}()
+	select {
+	case <-clientDone:
+	case <-p.stop:
+	}
+	serverIn.Close()
+	<-done
+}
 
-	logger.LogShutdown(serverName)
-	return cmd.Wait()
+// Stop makes Serve return without waiting for the client to disconnect:
+// the server process is terminated and no further client messages are
+// relayed.
+func (p *Proxy) Stop() {
+	p.stopOnce.Do(func() {
+		if p.stop != nil {
+			close(p.stop)
+		}
+		p.stopMu.Lock()
+		defer p.stopMu.Unlock()
+		if p.stopChild != nil {
+			p.stopChild()
+		}
+	})
 }
 
 // relayClientToServer reads from the client, evaluates tool calls, and forwards.
@@ -80,25 +226,60 @@ func (p *Proxy) relayClientToServer() {
 	scanner := bufio.NewScanner(p.clientReader)
 	scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024)
 	for scanner.Scan() {
+		metrics.MessageBytes.Observe(float64(len(scanner.Bytes())), p.serverName, "client_to_server")
+		if elems, ok := splitBatch(scanner.Bytes()); ok {
+			p.handleClientBatch(scanner.Bytes(), elems)
+			continue
+		}
 		p.handleClientMessage(scanner.Bytes())
 	}
 }
 
 // handleClientMessage processes a single message from the client.
 func (p *Proxy) handleClientMessage(data []byte) {
+	if p.rejected.Load() {
+		p.recorder.Record(recording.ClientToServer, data, "")
+		p.refuseRejected(data)
+		return
+	}
+
 	msg, err := ParseMessage(data)
 	if err != nil {
 		log.Printf("failed to parse client message: %v", err)
+		p.recorder.Record(recording.ClientToServer, data, "")
 		p.forward(data)
 		return
 	}
 
-	if msg.Method == "tools/call" {
+	if c := p.strippedCapability(msg.Method); c != "" {
+		p.recorder.Record(recording.ClientToServer, data, "")
+		p.refuseCapability(msg, c)
+		return
+	}
+
+	switch msg.Method {
+	case "tools/call":
 		p.handleToolCall(msg, data)
 		return
+	case "tools/list":
+		if p.aggregatesToolList(msg) {
+			p.recorder.Record(recording.ClientToServer, data, "")
+			p.listTools(msg)
+			return
+		}
+	case "initialize":
+		p.recordInitialize(msg)
+		p.trackCall(msg.ID, pendingCall{
+			method: msg.Method,
+			span:   p.tracer.Start("initialize", p.session.Context(), tracing.KindServer),
+		})
+		p.recorder.Record(recording.ClientToServer, data, "")
+		p.forward(p.negotiateRequest(msg))
+		return
 	}
 
 	// All other messages pass through
+	p.recorder.Record(recording.ClientToServer, data, "")
 	p.forward(data)
 }
 
@@ -107,38 +288,94 @@ func (p *Proxy) handleToolCall(msg *Message, raw []byte) {
 	tc, err := msg.AsToolCall()
 	if err != nil {
 		log.Printf("failed to parse tool call: %v", err)
+		p.recorder.Record(recording.ClientToServer, raw, "")
 		p.forward(raw)
 		return
 	}
 
+	correlationID := p.nextCorrelationID()
+	span := p.tracer.Start("tools/call "+tc.Name, p.callParent(msg), tracing.KindServer,
+		tracing.String("constellation.server", p.serverName),
+		tracing.String("mcp.tool", tc.Name),
+		tracing.String("constellation.correlation_id", correlationID))
+	eval := p.tracer.Start("policy.evaluate", span.Context(), tracing.KindInternal)
+
+	// At debug level the full evaluation trace is recorded; Explain makes
+	// the same decision as Evaluate but does more work to get there.
 	start := time.Now()
-	decision := p.engine.Evaluate(tc.Name, tc.Arguments)
-	durationMs := time.Since(start).Milliseconds()
+	engine := p.currentEngine()
+	var decision policy.Decision
+	var trace any
+	if p.logger.DebugEnabled() {
+		t := engine.Explain(tc.Name, tc.Arguments)
+		decision, trace = t.Decision, t
+	} else {
+		decision = engine.Evaluate(tc.Name, tc.Arguments)
+	}
+	elapsed := time.Since(start)
+	metrics.PolicyEvaluation.Observe(elapsed.Seconds(), p.serverName)
+
+	// A draining proxy refuses new calls, even in dry-run mode.
+	draining := p.draining.Load()
+	if draining {
+		decision = policy.Decision{Allow: false, MatchedRule: -1, Reason: "proxy is draining"}
+	}
 
 	decisionStr := "deny"
 	if decision.Allow {
 		decisionStr = "allow"
 	}
+	eval.SetAttributes(
+		tracing.String("constellation.decision", decisionStr),
+		tracing.Int("constellation.matched_rule", decision.MatchedRule))
+	eval.End()
 
-	p.logger.LogToolCall(audit.ToolCallEvent{
-		Server:     p.serverName,
-		Tool:       tc.Name,
-		Arguments:  tc.Arguments,
-		Decision:   decisionStr,
-		Rule:       decision.MatchedRule,
-		Reason:     decision.Reason,
-		DurationMs: durationMs,
+	logErr := p.logger.LogToolCall(audit.ToolCallEvent{
+		Server:        p.serverName,
+		Tool:          tc.Name,
+		Arguments:     tc.Arguments,
+		Decision:      decisionStr,
+		Rule:          decision.MatchedRule,
+		Reason:        decision.Reason,
+		DurationMs:    elapsed.Milliseconds(),
+		Trace:         trace,
+		RequestID:     msg.ID,
+		CorrelationID: correlationID,
 	})
 
-	if decision.Allow || p.dryRun {
-		p.forward(raw)
+	// A call that could not be audited is refused when the audit queue is
+	// configured to fail closed.
+	if logErr != nil && decision.Allow && !p.dryRun {
+		log.Printf("WARNING: denying %s: %v", tc.Name, logErr)
+		decision = policy.Decision{Allow: false, MatchedRule: -1, Reason: "audit log unavailable"}
+		decisionStr = "deny"
+	}
+	metrics.ToolCalls.Inc(p.serverName, p.metricTool(tc.Name), decisionStr)
+	span.SetAttributes(tracing.String("constellation.decision", decisionStr))
+	p.recordDecision(DecisionInfo{
+		Time:          time.Now().UTC(),
+		Tool:          tc.Name,
+		Decision:      decisionStr,
+		Rule:          decision.MatchedRule,
+		Reason:        decision.Reason,
+		CorrelationID: correlationID,
+	})
+	p.recorder.Record(recording.ClientToServer, raw, decisionStr)
+
+	if (decision.Allow || p.dryRun) && !draining {
+		upstream := p.tracer.Start("upstream tools/call", span.Context(), tracing.KindClient)
+		p.trackCall(msg.ID, pendingCall{method: msg.Method, tool: tc.Name, correlationID: correlationID, span: span, upstream: upstream})
+		p.forward(p.propagate(msg, raw, upstream))
 		return
 	}
 
+	span.SetError("denied by policy: " + decision.Reason)
+	span.End()
+
 	// Denied — send error response back to client
 	errResp := BuildErrorResponse(msg.ID, -32600, "tool call denied by policy: "+decision.Reason)
-	errResp = append(errResp, '\n')
-	p.clientWriter.Write(errResp)
+	p.recorder.Record(recording.ProxyToClient, errResp, "")
+	p.respond(errResp)
 }
 
 // relayServerToClient reads from the server and forwards to the client,
@@ -148,23 +385,55 @@ func (p *Proxy) relayServerToClient() {
 	scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024)
 	for scanner.Scan() {
 		data := scanner.Bytes()
+		metrics.MessageBytes.Observe(float64(len(data)), p.serverName, "server_to_client")
+		p.recorder.Record(recording.ServerToClient, data, "")
 
-		msg, err := ParseMessage(data)
-		if err != nil {
-			p.clientWriter.Write(append(data, '\n'))
+		if elems, ok := splitBatch(data); ok {
+			p.handleServerBatch(elems)
 			continue
 		}
+		p.handleServerMessage(data)
+	}
+}
+
+// handleServerMessage processes a single message from the server.
+func (p *Proxy) handleServerMessage(data []byte) {
+	msg, err := ParseMessage(data)
+	if err != nil {
+		p.respond(data)
+		return
+	}
 
-		// Filter tools/list responses
-		if msg.IsResponse() && msg.Result != nil {
-			if filtered, err := p.maybeFilterToolList(msg); err == nil && filtered != nil {
-				p.clientWriter.Write(append(filtered, '\n'))
-				continue
+	if msg.Method != "" && p.strippedCapability(msg.Method) != "" {
+		return
+	}
+	if msg.Method == "notifications/tools/list_changed" {
+		p.invalidateToolList()
+	}
+
+	if msg.IsResponse() {
+		if p.handleToolPage(msg) {
+			return
+		}
+		if msg.Result != nil && p.pendingMethod(msg.ID) == "initialize" {
+			msg = p.rewriteInitialize(msg)
+			if msg.Result != nil {
+				msg = p.negotiateResponse(msg)
 			}
+			data = msg.Raw
 		}
+		p.recordResult(msg)
+	}
 
-		p.clientWriter.Write(append(data, '\n'))
+	// Filter tools/list responses
+	if msg.IsResponse() && msg.Result != nil {
+		if filtered, err := p.maybeFilterToolList(msg); err == nil && filtered != nil {
+			p.respond(filtered)
+			return
+		}
 	}
+
+	p.respond(data)
 }
 
 // maybeFilterToolList checks if a response looks like a tools/list response
@@ -174,8 +443,9 @@ func (p *Proxy) maybeFilterToolList(msg *Message) ([]byte, error) {
 	if err != nil || len(tools) == 0 {
 		return nil, err
 	}
+	p.checkExposedTools(msg, tools)
 
-	allowed := p.engine.AllowedTools()
+	allowed := p.currentEngine().AllowedTools()
 	if len(allowed) == 0 {
 		return nil, nil
 	}
@@ -183,7 +453,46 @@ func (p *Proxy) maybeFilterToolList(msg *Message) ([]byte, error) {
 	return FilterToolListResponse(msg.Raw, allowed)
 }
 
+// checkExposedTools warns once about allow rules for tools the server does
+// not advertise. Paginated listings are accumulated until the last page.
+func (p *Proxy) checkExposedTools(msg *Message, tools []ToolInfo) {
+	if p.toolsChecked {
+		return
+	}
+	for _, t := range tools {
+		p.exposedTools = append(p.exposedTools, t.Name)
+	}
+	var page struct {
+		NextCursor string `json:"nextCursor"`
+	}
+	if err := json.Unmarshal(msg.Result, &page); err != nil || page.NextCursor != "" {
+		return
+	}
+	p.toolsChecked = true
+	for _, w := range config.CheckExposedTools(p.serverName, p.currentEngine().Server(), p.exposedTools) {
+		log.Printf("WARNING: %s", w)
+	}
+}
+
+// metricTool is the tool label for metrics: tools no rule names are
+// counted together as "other", bounding the labels a client can create.
+func (p *Proxy) metricTool(tool string) string {
+	if p.currentEngine().NamesTool(tool) {
+		return tool
+	}
+	return "other"
+}
+
 // forward sends data to the server's stdin.
 func (p *Proxy) forward(data []byte) {
+	p.forwardMu.Lock()
+	defer p.forwardMu.Unlock()
 	p.serverStdin.Write(append(data, '\n'))
 }
+
+// respond sends data to the client as one line.
+func (p *Proxy) respond(data []byte) {
+	p.respondMu.Lock()
+	defer p.respondMu.Unlock()
+	p.clientWriter.Write(append(data, '\n'))
+}
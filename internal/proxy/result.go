@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/metrics"
+	"github.com/bdubs00/constellation/internal/tracing"
+)
+
+// pendingCall is a request forwarded to the server and awaiting its
+// response: a tools/call, or an initialize being traced.
+type pendingCall struct {
+	requestID     any
+	method        string
+	tool          string
+	correlationID string
+	sent          time.Time
+	// span covers the whole request; upstream covers the round trip to
+	// the server.
+	span, upstream *tracing.Span
+}
+
+// requestKey distinguishes numeric and string JSON-RPC ids with the same
+// text.
+func requestKey(id any) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
+// trackCall remembers a forwarded request so its response can be audited
+// and its spans ended. A request without an id gets no response, so its
+// spans end now.
+func (p *Proxy) trackCall(id any, call pendingCall) {
+	if id == nil {
+		call.upstream.End()
+		call.span.End()
+		return
+	}
+	call.requestID, call.sent = id, time.Now()
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	if p.pending == nil {
+		p.pending = map[string]pendingCall{}
+	}
+	p.pending[requestKey(id)] = call
+}
+
+// recordResult logs a tool_result record if msg answers a tracked
+// tools/call, and ends the spans of any tracked request it answers.
+func (p *Proxy) recordResult(msg *Message) {
+	if msg.ID == nil {
+		return
+	}
+	key := requestKey(msg.ID)
+	p.pendingMu.Lock()
+	call, ok := p.pending[key]
+	delete(p.pending, key)
+	p.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+	call.upstream.End()
+	defer call.span.End()
+	if msg.Error != nil {
+		call.span.SetError(msg.Error.Message)
+	}
+	if call.method == "initialize" && msg.Error == nil {
+		p.initialized.Store(true)
+	}
+	if call.method != "tools/call" {
+		return
+	}
+
+	e := audit.ToolResultEvent{
+		Server:        p.serverName,
+		Tool:          call.tool,
+		RequestID:     msg.ID,
+		CorrelationID: call.correlationID,
+		Bytes:         len(msg.Raw),
+		Latency:       time.Since(call.sent),
+		Body:          msg.Result,
+	}
+	status := "ok"
+	if msg.Error != nil {
+		e.ErrorCode, e.ErrorMessage = msg.Error.Code, msg.Error.Message
+		status = "rpc_error"
+	} else if e.IsError, e.Content = summarizeResult(msg.Result, supportsStructuredContent(p.protocolVersion())); e.IsError {
+		status = "error"
+		call.span.SetError("tool returned an error")
+	}
+	call.span.SetAttributes(tracing.String("constellation.result", status))
+	p.logger.LogToolResult(e)
+	tool := p.metricTool(call.tool)
+	metrics.UpstreamLatency.Observe(e.Latency.Seconds(), p.serverName, tool)
+	metrics.ToolResults.Inc(p.serverName, tool, status)
+}
+
+// summarizeResult reads a tools/call result's isError flag and the type
+// and size of each content item. Sizes are of the text or encoded data
+// the item carries, or of the whole item for other types. If structured is
+// set, structuredContent is summarized as an item of type "structured".
+func summarizeResult(result json.RawMessage, structured bool) (bool, []audit.ContentSummary) {
+	var r struct {
+		IsError           bool              `json:"isError"`
+		Content           []json.RawMessage `json:"content"`
+		StructuredContent json.RawMessage   `json:"structuredContent"`
+	}
+	if err := json.Unmarshal(result, &r); err != nil {
+		return false, nil
+	}
+	var summary []audit.ContentSummary
+	for _, raw := range r.Content {
+		var item struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			Data     string `json:"data"`
+			Resource struct {
+				Text string `json:"text"`
+				Blob string `json:"blob"`
+			} `json:"resource"`
+		}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			continue
+		}
+		size := len(raw)
+		switch item.Type {
+		case "text":
+			size = len(item.Text)
+		case "image", "audio":
+			size = len(item.Data)
+		case "resource":
+			size = len(item.Resource.Text) + len(item.Resource.Blob)
+		}
+		summary = append(summary, audit.ContentSummary{Type: item.Type, Bytes: size})
+	}
+	if structured && len(r.StructuredContent) > 0 && string(r.StructuredContent) != "null" {
+		summary = append(summary, audit.ContentSummary{Type: "structured", Bytes: len(r.StructuredContent)})
+	}
+	return r.IsError, summary
+}
+
+// pendingMethod returns the method of the tracked request id answers, or
+// "" if it is not tracked.
+func (p *Proxy) pendingMethod(id any) string {
+	if id == nil {
+		return ""
+	}
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	return p.pending[requestKey(id)].method
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bdubs00/constellation/internal/audit"
+)
+
+// newSessionID returns a random identifier for one proxy run.
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// nextCorrelationID identifies one tool call within the session.
+func (p *Proxy) nextCorrelationID() string {
+	n := p.calls.Add(1)
+	if p.sessionID == "" {
+		return fmt.Sprintf("%d", n)
+	}
+	return fmt.Sprintf("%s-%d", p.sessionID, n)
+}
+
+// recordInitialize logs the client information from an initialize request.
+func (p *Proxy) recordInitialize(msg *Message) {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ClientInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"clientInfo"`
+	}
+	if len(msg.Params) > 0 {
+		json.Unmarshal(msg.Params, &params)
+	}
+	p.statusMu.Lock()
+	p.client = SessionInfo{
+		ClientName:       params.ClientInfo.Name,
+		ClientVersion:    params.ClientInfo.Version,
+		RequestedVersion: params.ProtocolVersion,
+	}
+	p.statusMu.Unlock()
+	p.logger.LogSession(audit.SessionEvent{
+		Server:          p.serverName,
+		ClientName:      params.ClientInfo.Name,
+		ClientVersion:   params.ClientInfo.Version,
+		ProtocolVersion: params.ProtocolVersion,
+	})
+}
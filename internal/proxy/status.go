@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/bdubs00/constellation/internal/policy"
+)
+
+// maxRecentDecisions bounds the decisions kept for RecentDecisions.
+const maxRecentDecisions = 100
+
+// SessionInfo describes the proxy's client session.
+type SessionInfo struct {
+	ID            string    `json:"id"`
+	Server        string    `json:"server"`
+	StartedAt     time.Time `json:"started_at"`
+	ClientName    string    `json:"client_name,omitempty"`
+	ClientVersion string    `json:"client_version,omitempty"`
+	// RequestedVersion is the protocol version the client asked for;
+	// ProtocolVersion is the version the server negotiated.
+	RequestedVersion string `json:"requested_version,omitempty"`
+	ProtocolVersion  string `json:"protocol_version,omitempty"`
+	Initialized      bool   `json:"initialized"`
+	// Rejected is set when the server negotiated a protocol version the
+	// policy does not allow; the session is over.
+	Rejected bool `json:"rejected,omitempty"`
+}
+
+// CallInfo describes a tool call forwarded to the server and awaiting its
+// response.
+type CallInfo struct {
+	RequestID     any       `json:"request_id"`
+	Tool          string    `json:"tool"`
+	CorrelationID string    `json:"correlation_id"`
+	StartedAt     time.Time `json:"started_at"`
+	ElapsedMs     int64     `json:"elapsed_ms"`
+}
+
+// DecisionInfo is one policy decision on a tool call.
+type DecisionInfo struct {
+	Time          time.Time `json:"time"`
+	Tool          string    `json:"tool"`
+	Decision      string    `json:"decision"`
+	Rule          int       `json:"matched_rule"`
+	Reason        string    `json:"reason,omitempty"`
+	CorrelationID string    `json:"correlation_id"`
+}
+
+// PolicyInfo describes the policy the proxy is enforcing. Hash identifies
+// everything but the server name and load time, so that proxies enforcing
+// the same policy report the same hash.
+type PolicyInfo struct {
+	Server            string            `json:"server"`
+	Hash              string            `json:"hash"`
+	LoadedAt          time.Time         `json:"loaded_at"`
+	Default           string            `json:"default"`
+	Rules             []PolicyRule      `json:"rules"`
+	Initialize        *PolicyInitialize `json:"initialize,omitempty"`
+	ProtocolVersions  []string          `json:"protocol_versions,omitempty"`
+	AggregateToolList bool              `json:"aggregate_tool_list,omitempty"`
+}
+
+// PolicyRule is one rule of a PolicyInfo.
+type PolicyRule struct {
+	Tool  string            `json:"tool"`
+	Allow bool              `json:"allow"`
+	When  map[string]string `json:"when,omitempty"`
+}
+
+// PolicyInitialize is the initialize section of a PolicyInfo.
+type PolicyInitialize struct {
+	StripCapabilities []string            `json:"strip_capabilities,omitempty"`
+	ServerInfo        *PolicyServerInfo   `json:"server_info,omitempty"`
+	Instructions      *PolicyInstructions `json:"instructions,omitempty"`
+}
+
+// PolicyServerInfo is the serverInfo a PolicyInitialize reports.
+type PolicyServerInfo struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// PolicyInstructions is how a PolicyInitialize rewrites instructions.
+type PolicyInstructions struct {
+	Strip   bool     `json:"strip,omitempty"`
+	Replace string   `json:"replace,omitempty"`
+	Remove  []string `json:"remove,omitempty"`
+}
+
+func (p *Proxy) currentEngine() *policy.Engine {
+	p.engineMu.RLock()
+	defer p.engineMu.RUnlock()
+	return p.engine
+}
+
+// SetEngine replaces the policy engine. Calls already forwarded are not
+// affected; the next call is evaluated against the new policy.
+func (p *Proxy) SetEngine(engine *policy.Engine) {
+	p.engineMu.Lock()
+	defer p.engineMu.Unlock()
+	p.engine, p.loadedAt = engine, time.Now()
+}
+
+// Policy describes the policy currently enforced.
+func (p *Proxy) Policy() PolicyInfo {
+	p.engineMu.RLock()
+	srv, loadedAt := p.engine.Server(), p.loadedAt
+	p.engineMu.RUnlock()
+
+	info := PolicyInfo{
+		Server:            p.serverName,
+		LoadedAt:          loadedAt.UTC(),
+		Default:           srv.Default,
+		Rules:             []PolicyRule{},
+		ProtocolVersions:  srv.ProtocolVersions,
+		AggregateToolList: srv.AggregatesToolList(),
+	}
+	for _, r := range srv.Rules {
+		info.Rules = append(info.Rules, PolicyRule{Tool: r.Tool, Allow: r.Allow, When: r.When})
+	}
+	if init := srv.Initialize; init != nil {
+		info.Initialize = &PolicyInitialize{StripCapabilities: init.StripCapabilities}
+		if init.ServerInfo != nil {
+			si := PolicyServerInfo(*init.ServerInfo)
+			info.Initialize.ServerInfo = &si
+		}
+		if init.Instructions != nil {
+			in := PolicyInstructions(*init.Instructions)
+			info.Initialize.Instructions = &in
+		}
+	}
+	hashed := info
+	hashed.Server, hashed.LoadedAt = "", time.Time{}
+	data, _ := json.Marshal(hashed)
+	sum := sha256.Sum256(data)
+	info.Hash = "sha256:" + hex.EncodeToString(sum[:])
+	return info
+}
+
+// Session describes the client session.
+func (p *Proxy) Session() SessionInfo {
+	p.statusMu.Lock()
+	info := p.client
+	p.statusMu.Unlock()
+	info.ID, info.Server, info.StartedAt = p.sessionID, p.serverName, p.startedAt.UTC()
+	info.Initialized = p.initialized.Load()
+	info.Rejected = p.rejected.Load()
+	return info
+}
+
+// Ready reports whether the server process is running and the client has
+// completed initialization with an allowed protocol version, and the proxy
+// is not draining. If not, reason
+// says why.
+func (p *Proxy) Ready() (ready bool, reason string) {
+	switch {
+	case p.rejected.Load():
+		return false, "protocol version rejected"
+	case !p.childUp.Load():
+		return false, "server process not running"
+	case !p.initialized.Load():
+		return false, "session not initialized"
+	case p.draining.Load():
+		return false, "draining"
+	}
+	return true, ""
+}
+
+// InFlight lists the tool calls awaiting a response, oldest first.
+func (p *Proxy) InFlight() []CallInfo {
+	now := time.Now()
+	p.pendingMu.Lock()
+	calls := []CallInfo{}
+	for _, c := range p.pending {
+		if c.method != "tools/call" {
+			continue
+		}
+		calls = append(calls, CallInfo{
+			RequestID:     c.requestID,
+			Tool:          c.tool,
+			CorrelationID: c.correlationID,
+			StartedAt:     c.sent.UTC(),
+			ElapsedMs:     now.Sub(c.sent).Milliseconds(),
+		})
+	}
+	p.pendingMu.Unlock()
+	sort.Slice(calls, func(i, j int) bool { return calls[i].StartedAt.Before(calls[j].StartedAt) })
+	return calls
+}
+
+func (p *Proxy) recordDecision(d DecisionInfo) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	if len(p.decisions) == maxRecentDecisions {
+		copy(p.decisions, p.decisions[1:])
+		p.decisions = p.decisions[:len(p.decisions)-1]
+	}
+	p.decisions = append(p.decisions, d)
+}
+
+// RecentDecisions returns up to n of the latest decisions, newest first;
+// n <= 0 returns all that are kept.
+func (p *Proxy) RecentDecisions(n int) []DecisionInfo {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	if n <= 0 || n > len(p.decisions) {
+		n = len(p.decisions)
+	}
+	out := make([]DecisionInfo, 0, n)
+	for i := len(p.decisions) - 1; len(out) < n; i-- {
+		out = append(out, p.decisions[i])
+	}
+	return out
+}
+
+// Drain stops the proxy accepting tool calls, which are denied from now
+// on, and waits until the calls in flight have been answered or ctx is
+// done. It returns the number still in flight.
+func (p *Proxy) Drain(ctx context.Context) int {
+	p.draining.Store(true)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n := len(p.InFlight())
+		if n == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return n
+		case <-ticker.C:
+		}
+	}
+}
+
+// Draining reports whether Drain has been called.
+func (p *Proxy) Draining() bool {
+	return p.draining.Load()
+}
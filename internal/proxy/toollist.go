@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/bdubs00/constellation/internal/recording"
+)
+
+// maxToolPages bounds how many tools/list pages are requested to build
+// the catalogue, in case a server keeps returning cursors.
+const maxToolPages = 100
+
+// toolCatalogue is the server's full tool list, gathered from every page
+// of tools/list for servers with aggregate_tool_list set. It is kept for
+// the session and refetched after notifications/tools/list_changed.
+type toolCatalogue struct {
+	mu    sync.Mutex
+	tools []json.RawMessage
+	valid bool
+
+	// While pages are being fetched, pageID is the id of the outstanding
+	// request, pages holds the tools gathered so far and waiting the ids
+	// of the client requests to answer. refetch is set when the list
+	// changed during the fetch.
+	fetching bool
+	pageID   string
+	pages    []json.RawMessage
+	pageNum  int
+	waiting  []any
+	refetch  bool
+	requests int
+}
+
+// listTools answers a client's tools/list request from the catalogue,
+// fetching it first if needed.
+func (p *Proxy) listTools(msg *Message) {
+	c := &p.catalogue
+	c.mu.Lock()
+	if c.valid {
+		tools := c.tools
+		c.mu.Unlock()
+		p.answerToolList(msg.ID, tools)
+		return
+	}
+	c.waiting = append(c.waiting, msg.ID)
+	if !c.fetching {
+		c.fetching, c.pages, c.pageNum = true, nil, 0
+		p.requestToolPage("")
+	}
+	c.mu.Unlock()
+}
+
+// requestToolPage asks the server for one page of tools. The caller holds
+// the catalogue lock.
+func (p *Proxy) requestToolPage(cursor string) {
+	c := &p.catalogue
+	c.requests++
+	c.pageNum++
+	c.pageID = fmt.Sprintf("constellation-tools-%d", c.requests)
+	req := map[string]any{"jsonrpc": "2.0", "id": c.pageID, "method": "tools/list"}
+	if cursor != "" {
+		req["params"] = map[string]any{"cursor": cursor}
+	}
+	data, _ := json.Marshal(req)
+	p.forward(data)
+}
+
+// handleToolPage consumes msg if it answers the proxy's own tools/list
+// request, requesting the next page or completing the catalogue. It
+// reports whether msg was consumed.
+func (p *Proxy) handleToolPage(msg *Message) bool {
+	c := &p.catalogue
+	c.mu.Lock()
+	if !c.fetching || msg.ID != c.pageID {
+		c.mu.Unlock()
+		return false
+	}
+
+	fail := func(code int, message string) {
+		waiting := c.waiting
+		c.fetching, c.waiting, c.pages, c.refetch = false, nil, nil, false
+		c.mu.Unlock()
+		log.Printf("WARNING: listing tools of %s: %s", p.serverName, message)
+		for _, id := range waiting {
+			p.replyToClient(BuildErrorResponse(id, code, message))
+		}
+	}
+	if msg.Error != nil {
+		fail(msg.Error.Code, msg.Error.Message)
+		return true
+	}
+	var page struct {
+		Tools      []json.RawMessage `json:"tools"`
+		NextCursor string            `json:"nextCursor"`
+	}
+	if err := json.Unmarshal(msg.Result, &page); err != nil {
+		fail(-32603, "invalid tools/list result: "+err.Error())
+		return true
+	}
+	c.pages = append(c.pages, page.Tools...)
+
+	switch {
+	case page.NextCursor != "" && c.pageNum >= maxToolPages:
+		fail(-32603, fmt.Sprintf("tools/list returned more than %d pages", maxToolPages))
+		return true
+	case page.NextCursor != "":
+		p.requestToolPage(page.NextCursor)
+		c.mu.Unlock()
+		return true
+	case c.refetch:
+		c.refetch, c.pages, c.pageNum = false, nil, 0
+		p.requestToolPage("")
+		c.mu.Unlock()
+		return true
+	}
+
+	tools, waiting := c.pages, c.waiting
+	c.tools, c.valid = tools, true
+	c.fetching, c.waiting, c.pages = false, nil, nil
+	c.mu.Unlock()
+
+	p.checkCatalogue(tools)
+	for _, id := range waiting {
+		p.answerToolList(id, tools)
+	}
+	return true
+}
+
+// invalidateToolList drops the cached catalogue after the server reports
+// that its tools changed.
+func (p *Proxy) invalidateToolList() {
+	c := &p.catalogue
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid, c.tools = false, nil
+	if c.fetching {
+		c.refetch = true
+	}
+	p.exposedTools, p.toolsChecked = nil, false
+}
+
+// checkCatalogue warns about allow rules for tools missing from the
+// complete catalogue.
+func (p *Proxy) checkCatalogue(tools []json.RawMessage) {
+	data, _ := json.Marshal(map[string]any{"result": map[string]any{"tools": tools}})
+	msg, err := ParseMessage(data)
+	if err != nil {
+		return
+	}
+	if infos, err := msg.AsToolList(); err == nil {
+		p.checkExposedTools(msg, infos)
+	}
+}
+
+// answerToolList sends the catalogue, filtered by the current policy, in
+// a single page.
+func (p *Proxy) answerToolList(id any, tools []json.RawMessage) {
+	if tools == nil {
+		tools = []json.RawMessage{}
+	}
+	data, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "result": map[string]any{"tools": tools}})
+	if err != nil {
+		p.replyToClient(BuildErrorResponse(id, -32603, err.Error()))
+		return
+	}
+	if allowed := p.currentEngine().AllowedTools(); len(allowed) > 0 {
+		if filtered, err := FilterToolListResponse(data, allowed); err == nil {
+			data = filtered
+		}
+	}
+	p.replyToClient(data)
+}
+
+// replyToClient sends a message the proxy composed itself.
+func (p *Proxy) replyToClient(data []byte) {
+	p.recorder.Record(recording.ProxyToClient, data, "")
+	p.respond(data)
+}
+
+// aggregatesToolList reports whether a tools/list request is answered
+// from the catalogue. Requests with a cursor, which can only come from
+// before aggregation was enabled, are passed through.
+func (p *Proxy) aggregatesToolList(msg *Message) bool {
+	if !p.currentEngine().Server().AggregatesToolList() {
+		return false
+	}
+	var params struct {
+		Cursor string `json:"cursor"`
+	}
+	if len(msg.Params) > 0 {
+		json.Unmarshal(msg.Params, &params)
+	}
+	return params.Cursor == ""
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"log"
+
+	"github.com/bdubs00/constellation/internal/tracing"
+)
+
+// callParent is the parent for a request's span: the trace context the
+// client passed in _meta.traceparent, or else the session span.
+func (p *Proxy) callParent(msg *Message) tracing.SpanContext {
+	if tp, ok := msg.Meta()["traceparent"].(string); ok {
+		if sc, ok := tracing.ParseTraceparent(tp); ok {
+			return sc
+		}
+	}
+	return p.session.Context()
+}
+
+// propagate replaces the trace context in a request's _meta with that of
+// span, so the server's own spans nest under the proxy's. Requests that
+// carry no traceparent are forwarded unchanged.
+func (p *Proxy) propagate(msg *Message, raw []byte, span *tracing.Span) []byte {
+	if span == nil {
+		return raw
+	}
+	if _, ok := msg.Meta()["traceparent"]; !ok {
+		return raw
+	}
+	out, err := SetMeta(raw, "traceparent", span.Context().Traceparent())
+	if err != nil {
+		log.Printf("WARNING: propagating trace context: %v", err)
+		return raw
+	}
+	return out
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+
+	"github.com/bdubs00/constellation/internal/recording"
+)
+
+// MCP protocol versions whose differences the proxy handles. Versions are
+// dates, so later versions compare greater.
+const (
+	Version20241105 = "2024-11-05"
+	// Version20250326 added JSON-RPC batching.
+	Version20250326 = "2025-03-26"
+	// Version20250618 removed batching and added structured tool output.
+	Version20250618 = "2025-06-18"
+)
+
+// supportsBatches reports whether version allows JSON-RPC batches.
+func supportsBatches(version string) bool {
+	return version == Version20250326
+}
+
+// supportsStructuredContent reports whether tool results may carry
+// structuredContent in version.
+func supportsStructuredContent(version string) bool {
+	return version >= Version20250618
+}
+
+// protocolVersion returns the negotiated protocol version, or "" before
+// the server has answered initialize.
+func (p *Proxy) protocolVersion() string {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	return p.client.ProtocolVersion
+}
+
+// negotiateRequest returns the initialize request to forward. If the
+// client asked for a version the policy does not allow, the newest allowed
+// version is requested instead, so the server answers with one the proxy
+// accepts if it can.
+func (p *Proxy) negotiateRequest(msg *Message) []byte {
+	allowed := p.currentEngine().Server().ProtocolVersions
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(msg.Params) > 0 {
+		json.Unmarshal(msg.Params, &params)
+	}
+	if len(allowed) == 0 || slices.Contains(allowed, params.ProtocolVersion) {
+		return msg.Raw
+	}
+	offer := slices.Max(allowed)
+	rewritten, err := setParam(msg.Raw, "protocolVersion", offer)
+	if err != nil {
+		log.Printf("WARNING: rewriting initialize request: %v", err)
+		return msg.Raw
+	}
+	log.Printf("client requested protocol version %q, which %s does not allow; requesting %q", params.ProtocolVersion, p.serverName, offer)
+	return rewritten
+}
+
+// negotiateResponse checks the version in the server's initialize result
+// against the allowlist. An allowed version becomes the session's; any
+// other is answered with an "Unsupported protocol version" error in place
+// of the result and ends the session: the server is stopped and later
+// client messages are refused.
+func (p *Proxy) negotiateResponse(msg *Message) *Message {
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	json.Unmarshal(msg.Result, &result)
+	allowed := p.currentEngine().Server().ProtocolVersions
+	if len(allowed) == 0 || slices.Contains(allowed, result.ProtocolVersion) {
+		p.statusMu.Lock()
+		p.client.ProtocolVersion = result.ProtocolVersion
+		p.statusMu.Unlock()
+		return msg
+	}
+
+	log.Printf("WARNING: %s negotiated protocol version %q, which is not allowed (allowed: %v)", p.serverName, result.ProtocolVersion, allowed)
+	p.rejectSession()
+	data, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      msg.ID,
+		"error": map[string]any{
+			"code":    -32602,
+			"message": "Unsupported protocol version",
+			"data":    map[string]any{"supported": allowed, "requested": result.ProtocolVersion},
+		},
+	})
+	rejected, err := ParseMessage(data)
+	if err != nil {
+		return msg
+	}
+	return rejected
+}
+
+// rejectSession stops forwarding to the server and terminates it.
+func (p *Proxy) rejectSession() {
+	p.rejected.Store(true)
+	p.forwardMu.Lock()
+	if c, ok := p.serverStdin.(io.Closer); ok {
+		c.Close()
+	}
+	p.forwardMu.Unlock()
+	p.stopMu.Lock()
+	defer p.stopMu.Unlock()
+	if p.stopChild != nil {
+		p.stopChild()
+	}
+}
+
+// refuseRejected answers a client request made after the session was
+// rejected. Notifications and unparseable lines are dropped.
+func (p *Proxy) refuseRejected(data []byte) {
+	msg, err := ParseMessage(data)
+	if err != nil || msg.ID == nil {
+		return
+	}
+	errResp := BuildErrorResponse(msg.ID, -32600, "session rejected: the server's protocol version is not allowed by policy")
+	p.recorder.Record(recording.ProxyToClient, errResp, "")
+	p.respond(errResp)
+}
+
+// splitBatch returns the elements of a JSON-RPC batch. ok is false if data
+// is not a JSON array.
+func splitBatch(data []byte) (elems []json.RawMessage, ok bool) {
+	trimmed := bytes.TrimLeft(data, " \t\r")
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, false
+	}
+	if err := json.Unmarshal(trimmed, &elems); err != nil {
+		return nil, false
+	}
+	return elems, true
+}
+
+// handleClientBatch evaluates each message of a client batch as if it had
+// been sent alone, so that no tool call escapes the policy. Batches are
+// refused unless the negotiated version allows them.
+func (p *Proxy) handleClientBatch(raw []byte, elems []json.RawMessage) {
+	version := p.protocolVersion()
+	if !supportsBatches(version) || len(elems) == 0 {
+		p.recorder.Record(recording.ClientToServer, raw, "")
+		reason := "JSON-RPC batches are not supported"
+		switch {
+		case version == "":
+			reason += " before initialization"
+		case len(elems) == 0:
+			reason = "empty JSON-RPC batch"
+		default:
+			reason += fmt.Sprintf(" in protocol version %s", version)
+		}
+		errResp := BuildErrorResponse(nil, -32600, reason)
+		p.recorder.Record(recording.ProxyToClient, errResp, "")
+		p.respond(errResp)
+		return
+	}
+	for _, elem := range elems {
+		p.handleClientMessage(elem)
+	}
+}
+
+// handleServerBatch relays each message of a server batch separately, so
+// that responses are audited and filtered. Batches the negotiated version
+// does not allow are dropped.
+func (p *Proxy) handleServerBatch(elems []json.RawMessage) {
+	if version := p.protocolVersion(); !supportsBatches(version) {
+		log.Printf("WARNING: dropping JSON-RPC batch from %s: not supported in protocol version %q", p.serverName, version)
+		return
+	}
+	for _, elem := range elems {
+		p.handleServerMessage(elem)
+	}
+}
@@ -0,0 +1,149 @@
+// Package recording captures the messages of a proxied MCP session and
+// replays them against a policy.
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Directions of recorded messages. ProxyToClient marks responses the proxy
+// made itself, such as policy denials.
+const (
+	ClientToServer = "client_to_server"
+	ServerToClient = "server_to_client"
+	ProxyToClient  = "proxy_to_client"
+)
+
+// Entry is one recorded message.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	// Decision is the policy decision, allow or deny, on a tools/call.
+	Decision string `json:"decision,omitempty"`
+	// Message is the JSON-RPC message as sent; Raw holds a line that was
+	// not valid JSON instead.
+	Message json.RawMessage `json:"message,omitempty"`
+	Raw     string          `json:"raw,omitempty"`
+}
+
+// Data returns the message bytes as they were sent.
+func (e Entry) Data() []byte {
+	if e.Message != nil {
+		return e.Message
+	}
+	return []byte(e.Raw)
+}
+
+// Recorder writes entries as JSON lines. A nil *Recorder records nothing.
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+	// scrub, if set, removes secrets from each JSON-encoded message.
+	scrub func([]byte) []byte
+	// failed suppresses repeated warnings after a write error.
+	failed bool
+}
+
+// NewRecorder returns a recorder that writes to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Create opens path for recording, truncating it. The file is readable
+// only by its owner, since recorded messages are not redacted beyond the
+// scrubber set by SetScrubber.
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening recording: %w", err)
+	}
+	return &Recorder{w: f, c: f}, nil
+}
+
+// SetScrubber sets a function applied to each message, JSON-encoded, before
+// it is written, such as audit.Redactor.ScrubSecrets to remove resolved
+// secrets. Lines that are not JSON are passed to it as a JSON string.
+func (r *Recorder) SetScrubber(scrub func([]byte) []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scrub = scrub
+}
+
+// Record writes one message. decision is empty except for tools/call
+// requests.
+func (r *Recorder) Record(direction string, data []byte, decision string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := Entry{Time: time.Now().UTC(), Direction: direction, Decision: decision}
+	if json.Valid(data) {
+		if r.scrub != nil {
+			data = r.scrub(data)
+		}
+		e.Message = append(json.RawMessage(nil), data...)
+	} else {
+		e.Raw = string(data)
+		if r.scrub != nil {
+			enc, _ := json.Marshal(e.Raw)
+			json.Unmarshal(r.scrub(enc), &e.Raw)
+		}
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil && !r.failed {
+		log.Printf("WARNING: writing session recording: %v", err)
+		r.failed = true
+	}
+}
+
+// Close closes the recording file, if the recorder opened one.
+func (r *Recorder) Close() error {
+	if r == nil || r.c == nil {
+		return nil
+	}
+	return r.c.Close()
+}
+
+// Read parses a recording.
+func Read(rd io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// ReadFile parses the recording at path.
+func ReadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,94 @@
+package recording
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bdubs00/constellation/internal/audit"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	r.Record(ClientToServer, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`), "allow")
+	r.Record(ServerToClient, []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), "")
+	r.Record(ClientToServer, []byte(`not json`), "")
+
+	entries, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if e := entries[0]; e.Direction != ClientToServer || e.Decision != "allow" || e.Time.IsZero() {
+		t.Errorf("entry 0 = %+v", e)
+	}
+	if got := string(entries[1].Data()); got != `{"jsonrpc":"2.0","id":1,"result":{}}` {
+		t.Errorf("entry 1 data = %s", got)
+	}
+	if got := string(entries[2].Data()); got != "not json" {
+		t.Errorf("invalid JSON recorded as %q", got)
+	}
+}
+
+func TestRecordScrubsSecrets(t *testing.T) {
+	redactor, err := audit.NewRedactor(audit.RedactOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactor.AddSecrets(map[string]string{"API_TOKEN": "s3cr3t\"value"})
+
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	r.SetScrubber(func(data []byte) []byte { return redactor.ScrubSecrets(data) })
+	r.Record(ServerToClient, []byte(`{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"token s3cr3t\"value"}]}}`), "")
+	r.Record(ServerToClient, []byte(`s3cr3t"value in a log line`), "")
+
+	if strings.Contains(buf.String(), "s3cr3t") {
+		t.Fatalf("recording contains the secret:\n%s", buf.String())
+	}
+	entries, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(entries[0].Data()); !strings.Contains(got, `token [REDACTED:API_TOKEN]`) {
+		t.Errorf("message = %s", got)
+	}
+	if got := string(entries[1].Data()); got != "[REDACTED:API_TOKEN] in a log line" {
+		t.Errorf("raw line = %q", got)
+	}
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *Recorder
+	r.Record(ClientToServer, []byte(`{}`), "")
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	r, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Record(ServerToClient, []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), "")
+	r.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("recording mode = %o, want 600", perm)
+	}
+	entries, err := ReadFile(path)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("ReadFile = %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,265 @@
+// Package replay re-drives a recorded MCP session through the proxy and
+// reports where the current policy decides differently.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bdubs00/constellation/internal/audit"
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/policy"
+	"github.com/bdubs00/constellation/internal/proxy"
+	"github.com/bdubs00/constellation/internal/recording"
+)
+
+// DefaultTimeout bounds the wait for each response.
+const DefaultTimeout = 10 * time.Second
+
+// Options configures a replay.
+type Options struct {
+	Server string
+	// Config is the server's entry from the policy. The proxy enforces it
+	// as run does, including its initialize, protocol_versions and
+	// aggregate_tool_list settings.
+	Config config.Server
+	// Live starts the server from Config and replays against it;
+	// otherwise requests are answered with the recorded server responses.
+	Live bool
+	Env  map[string]string
+	// Timeout bounds the wait for each response; DefaultTimeout if zero.
+	Timeout time.Duration
+}
+
+// Call is a tools/call request and the decisions made on it.
+type Call struct {
+	RequestID any
+	Tool      string
+	Recorded  string
+	Replayed  string
+}
+
+// Diverged reports whether the replay decided differently.
+func (c Call) Diverged() bool {
+	return c.Recorded != c.Replayed
+}
+
+// Report is the outcome of a replay.
+type Report struct {
+	Calls []Call
+	// Unanswered counts requests that got no response in time.
+	Unanswered int
+	// Unrecorded counts requests, such as calls the recording denied, that
+	// had no recorded response to replay.
+	Unrecorded int
+}
+
+// Divergences returns the calls decided differently.
+func (r *Report) Divergences() []Call {
+	var out []Call
+	for _, c := range r.Calls {
+		if c.Diverged() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Run replays the client side of entries through a proxy enforcing
+// opts.Config. Each request waits for its response before the next message
+// is sent, so decisions are made in the recorded order. Messages the
+// server sent unprompted are not replayed.
+func Run(entries []recording.Entry, opts Options) (*Report, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	var replayed bytes.Buffer
+	p := proxy.New(opts.Server, policy.NewEngine(opts.Config), audit.New(io.Discard), nil, false)
+	p.SetRecorder(recording.NewRecorder(&replayed))
+
+	clientIn, toProxy := io.Pipe()
+	fromProxy, clientOut := io.Pipe()
+	p.SetClient(clientIn, clientOut)
+
+	report := &Report{}
+	served := make(chan error, 1)
+	if opts.Live {
+		go func() { served <- p.Serve(opts.Config, opts.Env) }()
+	} else {
+		serverIn, proxyOut := io.Pipe()
+		proxyIn, serverOut := io.Pipe()
+		go func() {
+			report.Unrecorded = answerFromRecording(entries, serverIn, serverOut)
+			serverOut.Close()
+		}()
+		go func() {
+			p.ServeConn(proxyOut, proxyIn)
+			served <- nil
+		}()
+	}
+
+	w := newWaiter()
+	go w.read(fromProxy)
+
+	for _, e := range entries {
+		if e.Direction != recording.ClientToServer {
+			continue
+		}
+		data := e.Data()
+		msg, err := proxy.ParseMessage(data)
+		wait := err == nil && msg.Method != "" && msg.ID != nil
+		var answered <-chan struct{}
+		if wait {
+			answered = w.expect(msg.ID)
+		}
+		if _, err := toProxy.Write(append(append([]byte(nil), data...), '\n')); err != nil {
+			return nil, fmt.Errorf("replaying to proxy: %w", err)
+		}
+		if !wait {
+			continue
+		}
+		select {
+		case <-answered:
+		case <-time.After(opts.Timeout):
+			report.Unanswered++
+		}
+	}
+
+	toProxy.Close()
+	var err error
+	select {
+	case err = <-served:
+	case <-time.After(opts.Timeout):
+		err = fmt.Errorf("server did not exit within %s", opts.Timeout)
+	}
+	clientOut.Close()
+	if err != nil && opts.Live {
+		return nil, fmt.Errorf("running server: %w", err)
+	}
+
+	after, rerr := recording.Read(&replayed)
+	if rerr != nil {
+		return nil, rerr
+	}
+	report.Calls = pairCalls(toolCalls(entries), toolCalls(after))
+	return report, nil
+}
+
+// toolCalls returns the tools/call requests in entries that were decided.
+func toolCalls(entries []recording.Entry) []Call {
+	var calls []Call
+	for _, e := range entries {
+		if e.Direction != recording.ClientToServer || e.Decision == "" {
+			continue
+		}
+		msg, err := proxy.ParseMessage(e.Data())
+		if err != nil {
+			continue
+		}
+		tc, err := msg.AsToolCall()
+		if err != nil {
+			continue
+		}
+		calls = append(calls, Call{RequestID: msg.ID, Tool: tc.Name, Recorded: e.Decision})
+	}
+	return calls
+}
+
+// pairCalls matches recorded and replayed calls in order. A call that was
+// not replayed, for example because the client sent it after the server
+// stopped, has an empty Replayed decision.
+func pairCalls(recorded, replayed []Call) []Call {
+	for i := range recorded {
+		if i < len(replayed) {
+			recorded[i].Replayed = replayed[i].Recorded
+		}
+	}
+	return recorded
+}
+
+// answerFromRecording acts as the server, answering each request read from
+// in with the recorded response to the same id. Requests with no recorded
+// response get an error. It returns how many there were.
+func answerFromRecording(entries []recording.Entry, in io.Reader, out io.Writer) int {
+	responses := map[string][][]byte{}
+	for _, e := range entries {
+		if e.Direction != recording.ServerToClient {
+			continue
+		}
+		msg, err := proxy.ParseMessage(e.Data())
+		if err != nil || !msg.IsResponse() || msg.ID == nil {
+			continue
+		}
+		k := key(msg.ID)
+		responses[k] = append(responses[k], e.Data())
+	}
+
+	unrecorded := 0
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		msg, err := proxy.ParseMessage(scanner.Bytes())
+		if err != nil || msg.Method == "" || msg.ID == nil {
+			continue
+		}
+		k := key(msg.ID)
+		resp := proxy.BuildErrorResponse(msg.ID, -32603, "no recorded response")
+		if queue := responses[k]; len(queue) > 0 {
+			resp, responses[k] = queue[0], queue[1:]
+		} else {
+			unrecorded++
+		}
+		out.Write(append(append([]byte(nil), resp...), '\n'))
+	}
+	return unrecorded
+}
+
+// waiter signals when the proxy answers a request.
+type waiter struct {
+	mu      sync.Mutex
+	waiting map[string]chan struct{}
+}
+
+func newWaiter() *waiter {
+	return &waiter{waiting: map[string]chan struct{}{}}
+}
+
+// expect must be called before the request with id is sent.
+func (w *waiter) expect(id any) <-chan struct{} {
+	ch := make(chan struct{})
+	w.mu.Lock()
+	w.waiting[key(id)] = ch
+	w.mu.Unlock()
+	return ch
+}
+
+func (w *waiter) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			ID     any    `json:"id"`
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil || msg.ID == nil || msg.Method != "" {
+			continue
+		}
+		w.mu.Lock()
+		if ch, ok := w.waiting[key(msg.ID)]; ok {
+			close(ch)
+			delete(w.waiting, key(msg.ID))
+		}
+		w.mu.Unlock()
+	}
+	// Drain so the proxy never blocks writing to the client.
+	io.Copy(io.Discard, r)
+}
+
+func key(id any) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
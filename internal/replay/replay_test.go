@@ -0,0 +1,87 @@
+package replay
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/recording"
+)
+
+// session records an initialize and two tool calls, both allowed.
+func session(t *testing.T) []recording.Entry {
+	var buf bytes.Buffer
+	r := recording.NewRecorder(&buf)
+	r.Record(recording.ClientToServer, []byte(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{}}`), "")
+	r.Record(recording.ServerToClient, []byte(`{"jsonrpc":"2.0","id":0,"result":{"protocolVersion":"2025-06-18"}}`), "")
+	r.Record(recording.ClientToServer, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`), "")
+	r.Record(recording.ClientToServer, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file","arguments":{"path":"/public/a"}}}`), "allow")
+	r.Record(recording.ServerToClient, []byte(`{"jsonrpc":"2.0","id":1,"result":{"content":[]}}`), "")
+	r.Record(recording.ClientToServer, []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"write_file","arguments":{"path":"/public/a"}}}`), "allow")
+	r.Record(recording.ServerToClient, []byte(`{"jsonrpc":"2.0","id":2,"result":{"content":[]}}`), "")
+	entries, err := recording.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestReplayMatches(t *testing.T) {
+	srv := config.Server{Default: "allow"}
+	report, err := Run(session(t), Options{Server: "fs", Config: srv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Calls) != 2 || len(report.Divergences()) != 0 {
+		t.Errorf("calls = %+v", report.Calls)
+	}
+	if report.Unanswered != 0 || report.Unrecorded != 0 {
+		t.Errorf("unanswered %d, unrecorded %d", report.Unanswered, report.Unrecorded)
+	}
+}
+
+func TestReplayReportsDivergence(t *testing.T) {
+	srv := config.Server{
+		Default: "deny",
+		Rules:   []config.Rule{{Tool: "read_file", Allow: true}},
+	}
+	report, err := Run(session(t), Options{Server: "fs", Config: srv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := report.Divergences()
+	if len(d) != 1 || d[0].Tool != "write_file" || d[0].Recorded != "allow" || d[0].Replayed != "deny" {
+		t.Errorf("divergences = %+v", d)
+	}
+	if d[0].RequestID != 2.0 {
+		t.Errorf("request id = %v, want 2", d[0].RequestID)
+	}
+}
+
+func TestReplayAnswersUnrecordedRequests(t *testing.T) {
+	entries := session(t)
+	// Drop the recorded response to write_file, as if it had been denied.
+	entries = entries[:len(entries)-1]
+	srv := config.Server{Default: "allow"}
+	report, err := Run(entries, Options{Server: "fs", Config: srv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Unrecorded != 1 || report.Unanswered != 0 {
+		t.Errorf("unrecorded %d, unanswered %d", report.Unrecorded, report.Unanswered)
+	}
+}
+
+func TestReplayAppliesServerSettings(t *testing.T) {
+	// The recorded server negotiated 2025-06-18, which this policy does
+	// not allow, so the replayed session is rejected before any call.
+	srv := config.Server{Default: "allow", ProtocolVersions: []string{"2024-11-05"}}
+	report, err := Run(session(t), Options{Server: "fs", Config: srv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := report.Divergences()
+	if len(d) != 2 || d[0].Replayed != "" || d[1].Replayed != "" {
+		t.Errorf("divergences = %+v, want both calls unreplayed", d)
+	}
+}
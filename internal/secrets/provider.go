@@ -1,5 +1,7 @@
 package secrets
 
+import "github.com/bdubs00/constellation/internal/metrics"
+
 // Provider resolves secret references to their actual values.
 type Provider interface {
 	// Fetch resolves a secret reference string and returns the secret value.
@@ -15,10 +17,12 @@ func Resolve(refs map[string]string, providers map[string]Provider) (map[string]
 		prefix, remainder := parseReference(ref)
 		provider, ok := providers[prefix]
 		if !ok {
+			metrics.SecretResolutionFailures.Inc(prefix)
 			return nil, &UnknownProviderError{Prefix: prefix, Reference: ref}
 		}
 		val, err := provider.Fetch(remainder)
 		if err != nil {
+			metrics.SecretResolutionFailures.Inc(prefix)
 			return nil, &FetchError{Reference: ref, Err: err}
 		}
 		resolved[envName] = val
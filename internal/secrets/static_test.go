@@ -3,6 +3,8 @@ package secrets
 import (
 	"os"
 	"testing"
+
+	"github.com/bdubs00/constellation/internal/metrics"
 )
 
 func TestStaticProviderFromEnv(t *testing.T) {
@@ -54,8 +56,12 @@ func TestResolveUnknownProvider(t *testing.T) {
 	refs := map[string]string{
 		"SECRET": "unknown:something",
 	}
+	before := metrics.SecretResolutionFailures.Value("unknown")
 	_, err := Resolve(refs, providers)
 	if err == nil {
 		t.Fatal("expected error for unknown provider")
 	}
+	if got := metrics.SecretResolutionFailures.Value("unknown") - before; got != 1 {
+		t.Errorf("resolution failures counted = %v, want 1", got)
+	}
 }
@@ -14,6 +14,7 @@ import (
 	approle "github.com/hashicorp/vault/api/auth/approle"
 
 	"github.com/bdubs00/constellation/internal/config"
+	"github.com/bdubs00/constellation/internal/metrics"
 )
 
 // VaultProvider fetches secrets from HashiCorp Vault.
@@ -148,8 +149,11 @@ func (p *VaultProvider) StartRenewal() (cancel func()) {
 		})
 		if err != nil {
 			log.Printf("WARNING: failed to start vault token renewal: %v", err)
+			metrics.VaultRenewals.Inc("failure")
+			metrics.VaultRenewalHealthy.Set(0)
 			return
 		}
+		metrics.VaultRenewalHealthy.Set(1)
 
 		go watcher.Start()
 		defer watcher.Stop()
@@ -161,10 +165,13 @@ func (p *VaultProvider) StartRenewal() (cancel func()) {
 			case err := <-watcher.DoneCh():
 				if err != nil {
 					log.Printf("WARNING: vault token renewal stopped: %v", err)
+					metrics.VaultRenewals.Inc("failure")
 				}
+				metrics.VaultRenewalHealthy.Set(0)
 				return
 			case <-watcher.RenewCh():
 				log.Println("vault token renewed successfully")
+				metrics.VaultRenewals.Inc("success")
 			}
 		}
 	}()
@@ -0,0 +1,248 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLPOptions configures an OTLPExporter.
+type OTLPOptions struct {
+	// URL is the collector endpoint, e.g. http://localhost:4318; /v1/traces
+	// is appended unless the URL already ends with it.
+	URL     string
+	Headers map[string]string
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+	// BufferSize spans may wait for export before new ones are dropped;
+	// they are sent every FlushInterval or once BatchSize are queued.
+	BufferSize    int
+	BatchSize     int
+	FlushInterval time.Duration
+	// Timeout bounds each export request.
+	Timeout time.Duration
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding. Export never blocks; spans that cannot be queued or
+// delivered are dropped, since tracing must not slow tool calls down.
+type OTLPExporter struct {
+	opts  OTLPOptions
+	queue chan SpanData
+	flush chan chan struct{}
+	done  chan struct{}
+	// failing suppresses repeated warnings while the collector is down.
+	failing bool
+}
+
+// NewOTLPExporter starts an exporter.
+func NewOTLPExporter(opts OTLPOptions) *OTLPExporter {
+	if !strings.HasSuffix(opts.URL, "/v1/traces") {
+		opts.URL = strings.TrimSuffix(opts.URL, "/") + "/v1/traces"
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = "constellation"
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 2048
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	e := &OTLPExporter{
+		opts:  opts,
+		queue: make(chan SpanData, opts.BufferSize),
+		flush: make(chan chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Export queues span for delivery, dropping it if the queue is full.
+func (e *OTLPExporter) Export(span SpanData) {
+	select {
+	case e.queue <- span:
+	default:
+	}
+}
+
+// Shutdown delivers queued spans and stops the exporter.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case e.flush <- ack:
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= e.opts.BatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		case ack := <-e.flush:
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			e.send(batch)
+			close(ack)
+			return
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []SpanData) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(otlpRequest(e.opts.ServiceName, batch))
+	if err == nil {
+		err = e.post(body)
+	}
+	switch {
+	case err != nil && !e.failing:
+		log.Printf("WARNING: exporting traces to %s: %v", e.opts.URL, err)
+		e.failing = true
+	case err == nil && e.failing:
+		log.Printf("exporting traces to %s recovered", e.opts.URL)
+		e.failing = false
+	}
+}
+
+func (e *OTLPExporter) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", e.opts.URL, resp.Status)
+	}
+	return nil
+}
+
+// The types below are the subset of ExportTraceServiceRequest we send.
+
+type otlpAttr struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              Kind       `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	// Code is 0 for unset and 2 for error.
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpAttrs(attrs []Attr) []otlpAttr {
+	out := make([]otlpAttr, 0, len(attrs))
+	for _, a := range attrs {
+		var v map[string]any
+		switch val := a.Value.(type) {
+		case bool:
+			v = map[string]any{"boolValue": val}
+		case int:
+			v = map[string]any{"intValue": strconv.Itoa(val)}
+		case int64:
+			v = map[string]any{"intValue": strconv.FormatInt(val, 10)}
+		case float64:
+			v = map[string]any{"doubleValue": val}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(val)}
+		}
+		out = append(out, otlpAttr{Key: a.Key, Value: v})
+	}
+	return out
+}
+
+func otlpRequest(service string, batch []SpanData) map[string]any {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.Context.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.Context.SpanID[:]),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttrs(s.Attributes),
+		}
+		if s.Parent != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.Parent[:])
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.Error}
+		}
+		spans = append(spans, span)
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttrs([]Attr{String("service.name", service)}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "constellation.proxy"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
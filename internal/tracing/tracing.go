@@ -0,0 +1,194 @@
+// Package tracing records OpenTelemetry spans for MCP sessions and tool
+// calls and propagates W3C trace context.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	// Sampled is the W3C trace-flags sampled bit.
+	Sampled bool
+}
+
+// IsValid reports whether sc has non-zero trace and span IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value. It reports false
+// for a malformed value or one with all-zero IDs.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	// Version 00 has exactly four fields; later versions may add more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// Kind is the OpenTelemetry span kind.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Attr is a span attribute. Values are strings, bools, ints or float64s.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String, Int and Bool build attributes.
+func String(key, value string) Attr    { return Attr{key, value} }
+func Int(key string, value int) Attr   { return Attr{key, value} }
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// SpanData is a finished span, as handed to an Exporter.
+type SpanData struct {
+	Name       string
+	Context    SpanContext
+	Parent     [8]byte
+	Kind       Kind
+	Start, End time.Time
+	Attributes []Attr
+	// Error is set for a span that ended in an error.
+	Error string
+}
+
+// Exporter delivers finished spans.
+type Exporter interface {
+	Export(SpanData)
+	// Shutdown delivers any queued spans, giving up when ctx is done.
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer starts spans and hands them to its exporter when they end. A nil
+// *Tracer is valid and records nothing.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a tracer that exports spans through exp.
+func NewTracer(exp Exporter) *Tracer {
+	return &Tracer{exporter: exp}
+}
+
+// Start begins a span. If parent is valid the span joins its trace;
+// otherwise it starts a new, sampled trace.
+func (t *Tracer) Start(name string, parent SpanContext, kind Kind, attrs ...Attr) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{tracer: t, data: SpanData{Name: name, Kind: kind, Start: time.Now(), Attributes: attrs}}
+	if parent.IsValid() {
+		s.data.Context.TraceID = parent.TraceID
+		s.data.Context.Sampled = parent.Sampled
+		s.data.Parent = parent.SpanID
+	} else {
+		rand.Read(s.data.Context.TraceID[:])
+		s.data.Context.Sampled = true
+	}
+	rand.Read(s.data.Context.SpanID[:])
+	return s
+}
+
+// Shutdown flushes spans that have ended.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// Span is an operation being traced. Methods on a nil *Span do nothing.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// Context returns the span's context, or the zero SpanContext for a nil
+// span.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = msg
+}
+
+// End finishes the span and exports it if it is sampled. Only the first
+// call has any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	if data.Context.Sampled {
+		s.tracer.exporter.Export(data)
+	}
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(tp)
+	if !ok || !sc.Sampled {
+		t.Fatalf("ParseTraceparent(%q) = %+v, %v", tp, sc, ok)
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Errorf("Traceparent() = %q, want %q", got, tp)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("ParseTraceparent(%q) accepted", bad)
+		}
+	}
+	// Later versions may append fields.
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Error("future version rejected")
+	}
+}
+
+// recorder is an Exporter that keeps spans in memory.
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(s SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *recorder) Shutdown(context.Context) error { return nil }
+
+func TestSpans(t *testing.T) {
+	rec := &recorder{}
+	tracer := NewTracer(rec)
+
+	root := tracer.Start("root", SpanContext{}, KindInternal)
+	child := tracer.Start("child", root.Context(), KindClient, String("k", "v"))
+	child.SetError("failed")
+	child.End()
+	child.End()
+	root.End()
+
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	tracer.Start("dropped", unsampled, KindInternal).End()
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(rec.spans))
+	}
+	c, r := rec.spans[0], rec.spans[1]
+	if c.Context.TraceID != r.Context.TraceID || c.Parent != r.Context.SpanID {
+		t.Errorf("child %+v is not under root %+v", c.Context, r.Context)
+	}
+	if c.Error != "failed" || len(c.Attributes) != 1 {
+		t.Errorf("child = %+v", c)
+	}
+
+	var nilTracer *Tracer
+	span := nilTracer.Start("x", SpanContext{}, KindInternal)
+	span.SetAttributes(Bool("b", true))
+	span.End()
+	if span.Context().IsValid() {
+		t.Error("nil tracer produced a valid span context")
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	got := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer x" {
+			t.Errorf("request to %s with auth %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]any
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		got <- req
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(OTLPOptions{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer x"}, FlushInterval: time.Hour})
+	tracer := NewTracer(exp)
+	span := tracer.Start("tools/call read_file", SpanContext{}, KindServer, String("mcp.tool", "read_file"), Int("n", 3))
+	span.SetError("denied")
+	span.End()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-got
+	rs := req["resourceSpans"].([]any)[0].(map[string]any)
+	spans := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	s := spans[0].(map[string]any)
+	if s["name"] != "tools/call read_file" || s["kind"] != 2.0 || len(s["traceId"].(string)) != 32 {
+		t.Errorf("span = %v", s)
+	}
+	if status := s["status"].(map[string]any); status["code"] != 2.0 || status["message"] != "denied" {
+		t.Errorf("status = %v", status)
+	}
+	if _, ok := s["parentSpanId"]; ok {
+		t.Error("root span has a parent")
+	}
+}
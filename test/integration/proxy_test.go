@@ -12,27 +12,24 @@ import (
 )
 
 func TestProxyEndToEnd(t *testing.T) {
-	// Build the echo server
-	echoServer := filepath.Join(t.TempDir(), "echo-server")
-	build := exec.Command("go", "build", "-o", echoServer, "./echo_server.go")
-	build.Dir = "."
-	if out, err := build.CombinedOutput(); err != nil {
-		t.Fatalf("building echo server: %v\n%s", err, out)
-	}
-
-	// Build constellation
+	// Build constellation, which also serves as the MCP server
 	constellation := filepath.Join(t.TempDir(), "constellation")
-	build = exec.Command("go", "build", "-o", constellation, "../../cmd/constellation")
+	build := exec.Command("go", "build", "-o", constellation, "../../cmd/constellation")
 	if out, err := build.CombinedOutput(); err != nil {
 		t.Fatalf("building constellation: %v\n%s", err, out)
 	}
+	spec, err := filepath.Abs("testdata/echo.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Write a test policy
 	policyContent := `
 version: "1"
 servers:
   echo:
-    command: "` + echoServer + `"
+    command: "` + constellation + `"
+    args: [mock-server, "` + spec + `"]
     default: deny
     rules:
       - tool: read_file